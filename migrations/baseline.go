@@ -0,0 +1,108 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMetadataNotEmpty returned by Baseline if migrations have already been recorded
+	// in the metadata table, and the baseline isn't forced.
+	ErrMetadataNotEmpty = errors.New("metadata table already has migrations")
+)
+
+// Baseline records every migration up to and including the revision as applied, without
+// running them.  Use this when adopting migrations on a database whose schema was created
+// by hand or by another tool.  If embedded rollbacks are enabled, the "down" SQL of each
+// migration is stored in the metadata table, so the migrations may be rolled back later.
+//
+// Returns ErrMetadataNotEmpty if any migrations are already recorded in the metadata
+// table, unless the options are forced with WithForce, in which case migrations already
+// recorded are left as they are.
+func (options Options) Baseline(ctx context.Context, span Span, revision int) error {
+	err := options.markApplied(ctx, span, func(rev int) bool {
+		return rev <= revision
+	})
+	if err != nil {
+		return fmt.Errorf("unable to baseline at revision %d: %w", revision, err)
+	}
+
+	return nil
+}
+
+// Records the migrations whose revisions are included as applied, without running them.
+// Returns ErrMetadataNotEmpty if any migrations are already recorded, unless forced.
+func (options Options) markApplied(ctx context.Context, span Span, include func(rev int) bool) error {
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := options.available(Up)
+	if err != nil {
+		return err
+	}
+
+	registered := options.goMigrations()
+
+	unlock, err := options.advisoryLock(ctx, span, metadataTable)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock(ctx)
+	}()
+
+	tx, err := Begin(ctx, span)
+	if err != nil {
+		return err
+	}
+	defer TxClose(ctx, tx)
+
+	if options.Locking != LockAdvisory {
+		if err := lockMetadata(ctx, tx, metadataTable, options.LockWait); err != nil {
+			return err
+		}
+		defer tx.UnlockMetadata(ctx, metadataTable)
+	}
+
+	applied, err := appliedMigrations(ctx, tx, metadataTable, options.source)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) > 0 && !options.Force {
+		return ErrMetadataNotEmpty
+	}
+
+	for _, migration := range migrations {
+		rev, err := Revision(migration)
+		if err != nil || !include(rev) {
+			continue
+		}
+
+		if IsMigrated(ctx, tx, metadataTable, migration) {
+			continue
+		}
+
+		if gm, ok := registered[migration]; ok {
+			err = goMigrated(ctx, tx, metadataTable, gm, options.EmbeddedRollbacks)
+		} else {
+			err = Migrated(ctx, tx, options.reader(), metadataTable, Join(options.Directory, migration), Up, options.EmbeddedRollbacks)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := RecordRun(ctx, tx, metadataTable, migration, 0, options.AppliedBy, options.Env); err != nil {
+			return err
+		}
+	}
+
+	return tx.CommitMigration(ctx)
+}
@@ -0,0 +1,160 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ChecksumMode controls how Apply and AtLatest handle applied migrations whose files
+// have changed since they were applied.
+type ChecksumMode string
+
+const (
+	// ChecksumVerify fails with a ChecksumError if any applied migration files were
+	// modified.
+	ChecksumVerify ChecksumMode = "verify"
+
+	// ChecksumWarn logs a warning if any applied migration files were modified, but
+	// continues on.
+	ChecksumWarn ChecksumMode = "warn"
+
+	// ChecksumIgnore skips checking the checksums.  This is the default; the checksums
+	// are still recorded, so checking may be turned on later.
+	ChecksumIgnore ChecksumMode = "ignore"
+)
+
+var (
+	// ErrChecksumMismatch returned if an applied migration file was modified after
+	// it was applied.  See ChecksumError for the list of migrations.
+	ErrChecksumMismatch = errors.New("applied migrations were modified")
+)
+
+// ChecksumError lists the migrations whose "up" SQL changed after they were applied to
+// the database.  errors.Is(err, ErrChecksumMismatch) returns true for a ChecksumError.
+type ChecksumError struct {
+	Migrations []string
+}
+
+// Error lists the modified migrations.
+func (e *ChecksumError) Error() string {
+	return ErrChecksumMismatch.Error() + ": " + strings.Join(e.Migrations, ", ")
+}
+
+// Is matches ErrChecksumMismatch.
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// Checksum returns the SHA-256 hash of the "up" SQL in the migration, as a hex string.
+// Whitespace is normalized before hashing, so reformatting the SQL doesn't change the
+// checksum.  The SQL is hashed before an EnvReader filters it for the environment, so the
+// checksum is the same in every environment.
+func Checksum(reader Reader, path string) (string, error) {
+	if env, ok := reader.(*EnvReader); ok {
+		reader = env.Reader
+	}
+
+	upSQL, err := ReadSQL(reader, path, Up)
+	if err != nil {
+		return "", err
+	}
+
+	return checksumSQL(upSQL), nil
+}
+
+// Hashes the SQL with its whitespace normalized.
+func checksumSQL(SQL string) string {
+	normalized := strings.Join(strings.Fields(SQL), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChecksums compares the checksums recorded in the metadata table with the current
+// migration files.  Returns a ChecksumError listing the modified migrations.  Migrations
+// applied before checksums were recorded, or whose files are no longer available, are
+// skipped.
+func (options Options) VerifyChecksums(ctx context.Context, span Span, metadataTable string) error {
+	available, err := Available(options.Reader, options.Directory, Up)
+	if err != nil {
+		return err
+	}
+
+	recorded, err := checksums(ctx, span, metadataTable)
+	if err != nil {
+		return err
+	}
+
+	var modified []string
+	for _, migration := range available {
+		checksum, ok := recorded[migration]
+		if !ok {
+			continue
+		}
+
+		current, err := Checksum(options.Reader, Join(options.Directory, migration))
+		if err != nil {
+			return err
+		}
+
+		if current != checksum {
+			modified = append(modified, migration)
+		}
+	}
+
+	if len(modified) == 0 {
+		return nil
+	}
+
+	return &ChecksumError{Migrations: modified}
+}
+
+// Checks the checksums according to the ChecksumMode.
+func (options Options) checkChecksums(ctx context.Context, span Span, metadataTable string) error {
+	switch options.Checksums {
+	case ChecksumVerify:
+		return options.VerifyChecksums(ctx, span, metadataTable)
+
+	case ChecksumWarn:
+		err := options.VerifyChecksums(ctx, span, metadataTable)
+
+		var mismatch *ChecksumError
+		if errors.As(err, &mismatch) {
+			options.logger().Warn("applied migrations were modified", "migrations", mismatch.Migrations)
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Returns the checksums recorded in the metadata table, mapped by migration filename.
+func checksums(ctx context.Context, span Span, metadataTable string) (map[string]string, error) {
+	rows, err := span.QueryMigration(ctx, "select migration, checksum from "+metadataTable+" where checksum is not null")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	results := make(map[string]string)
+
+	for rows.Next() {
+		var migration string
+		var checksum sql.NullString
+
+		if err := rows.Scan(&migration, &checksum); err != nil {
+			return nil, err
+		}
+
+		results[migration] = checksum.String
+	}
+
+	return results, rows.Err()
+}
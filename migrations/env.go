@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// EnvReader wraps a Reader to filter each migration file's sections for an environment,
+// such as "dev", "test", or "production".  The SQL in a section scoped to other
+// environments, e.g. `--- !Up env=dev,test` when the environment is "production", is
+// replaced with a comment, so ReadSQL only includes the sections that match.  Sections
+// that aren't scoped to any environment are always included.  If the environment is
+// blank, every scoped section is skipped.
+//
+// Apply, Plan, and Baseline read the migrations through an EnvReader for the options'
+// Env, so a migration whose sections are all skipped is still recorded as applied.
+type EnvReader struct {
+	Reader Reader
+	Env    string
+}
+
+// Files returns the files from the underlying Reader.
+func (r *EnvReader) Files(directory string) ([]string, error) {
+	return r.Reader.Files(directory)
+}
+
+// Read the SQL migration from the underlying Reader, with the SQL in the sections for
+// other environments replaced by a comment.
+func (r *EnvReader) Read(path string) (io.Reader, error) {
+	f, err := r.Reader.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
+	}
+
+	var b bytes.Buffer
+	skipping := false
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+
+		if found := dirRe.FindStringSubmatch(line); len(found) > 2 {
+			var section Section
+			section.parse(found[2])
+
+			b.WriteString(line + "\n")
+
+			skipping = !section.InEnv(r.Env)
+			if skipping {
+				b.WriteString("-- skipped, only for env=" + strings.Join(section.Env, ",") + "\n")
+			}
+
+			continue
+		}
+
+		if !skipping {
+			b.WriteString(line + "\n")
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// Returns the environment the Reader filters the migrations for, if it's an EnvReader.
+func readerEnv(reader Reader) string {
+	if env, ok := reader.(*EnvReader); ok {
+		return env.Env
+	}
+
+	return ""
+}
+
+// Returns the options' Reader filtered for the options' Env.
+func (options Options) reader() Reader {
+	return &EnvReader{Reader: options.Reader, Env: options.Env}
+}
@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EventType identifies the stage of a migration reported in an Event.
+type EventType string
+
+const (
+	// EventStart is emitted before a migration is applied or rolled back.
+	EventStart EventType = "start"
+
+	// EventFinish is emitted after a migration is successfully applied or rolled back.
+	EventFinish EventType = "finish"
+
+	// EventFailure is emitted if applying or rolling back a migration fails.
+	EventFailure EventType = "failure"
+)
+
+// The attribute names used when logging migration events.  These are stable, so log
+// pipelines may rely on them, e.g. to alert on failures.
+const (
+	AttrEvent     = "migration.event"
+	AttrMigration = "migration.name"
+	AttrDirection = "migration.direction"
+	AttrEmbedded  = "migration.embedded"
+	AttrDuration  = "migration.duration_ms"
+	AttrError     = "migration.error"
+	AttrSchema    = "migration.schema" // the tenant schema, when migrating tenants
+	AttrSource    = "migration.source" // the source name, when migrating sources
+)
+
+// Hook is called with each migration event.  Hooks are called synchronously, so they
+// should return quickly.
+type Hook func(ctx context.Context, event Event)
+
+// Event reports the progress of a single migration being applied or rolled back.
+type Event struct {
+	// Type is the stage of the migration:  start, finish, or failure.
+	Type EventType
+
+	// Migration is the filename of the migration.
+	Migration string
+
+	// Direction indicates if the migration is being applied (Up) or rolled back (Down).
+	Direction Direction
+
+	// Embedded is true if the migration is being rolled back using the rollback
+	// embedded in the metadata table.
+	Embedded bool
+
+	// Duration is how long the migration ran.  Zero for EventStart.
+	Duration time.Duration
+
+	// Err is the reason the migration failed, for EventFailure.
+	Err error
+}
+
+// Attrs returns the event as log attributes, using the stable Attr* names.
+func (event Event) Attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String(AttrEvent, string(event.Type)),
+		slog.String(AttrMigration, event.Migration),
+		slog.String(AttrDirection, string(event.Direction)),
+		slog.Bool(AttrEmbedded, event.Embedded),
+	}
+
+	if event.Type != EventStart {
+		attrs = append(attrs, slog.Int64(AttrDuration, event.Duration.Milliseconds()))
+	}
+
+	if event.Err != nil {
+		attrs = append(attrs, slog.String(AttrError, event.Err.Error()))
+	}
+
+	return attrs
+}
+
+// Returns a copy of the event for the stage.
+func (event Event) with(eventType EventType, duration time.Duration, err error) Event {
+	event.Type = eventType
+	event.Duration = duration
+	event.Err = err
+
+	return event
+}
+
+// Returns the log message for the event.
+func (event Event) message() string {
+	switch event.Type {
+	case EventStart:
+		return "migration started"
+	case EventFinish:
+		return "migration finished"
+	default:
+		return "migration failed"
+	}
+}
+
+// Reports the event to the hook and logger, if configured.
+func (m Migration) emit(ctx context.Context, event Event) {
+	if m.hook != nil {
+		m.hook(ctx, event)
+	}
+
+	if m.logger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	if event.Type == EventFailure {
+		level = slog.LevelError
+	}
+
+	m.logger.LogAttrs(ctx, level, event.message(), event.Attrs()...)
+}
+
+// Returns the options' logger for warnings, or a logger that discards them if there
+// isn't one.
+func (options Options) logger() *slog.Logger {
+	if options.Logger != nil {
+		return options.Logger
+	}
+
+	return discard
+}
+
+// Logs nothing, for when the options don't have a Logger.
+var discard = slog.New(discardHandler{})
+
+// A slog.Handler that's never enabled, so nothing is formatted or logged.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// GolangMigrateTable is the default name of golang-migrate's version table.
+const GolangMigrateTable = "schema_migrations"
+
+var (
+	// ErrDirtyImport returned by ImportGolangMigrate if golang-migrate's version table is
+	// marked dirty, i.e. a migration failed partway.  Fix the database and clear the
+	// dirty flag with golang-migrate before importing.
+	ErrDirtyImport = errors.New("golang-migrate version is dirty")
+)
+
+// GolangMigrateReader wraps a Reader to read a directory of golang-migrate migrations,
+// e.g. `0001_create_users.up.sql` and `0001_create_users.down.sql`, as drawbridge
+// migrations.  Each pair of files is presented as a single migration file, e.g.
+// `0001-create_users.sql`, with the "up" file as its `--- !Up` section and the "down"
+// file as its `--- !Down` section:
+//
+//	reader := migrations.FromGolangMigrate(new(migrations.DiskReader))
+//	options := migrations.WithDirectory("db/migrations").WithReader(reader)
+//
+// A migration without a "down" file has an empty "down" section, so rolling it back
+// only removes it from the metadata table, as in golang-migrate.
+type GolangMigrateReader struct {
+	Reader Reader
+}
+
+// FromGolangMigrate returns a [Reader] for the golang-migrate migrations read by the
+// reader.
+func FromGolangMigrate(reader Reader) *GolangMigrateReader {
+	return &GolangMigrateReader{Reader: reader}
+}
+
+// Files returns a drawbridge migration filename for each golang-migrate "up" file in the
+// directory.  Files that aren't golang-migrate "up" files are ignored.
+func (r *GolangMigrateReader) Files(directory string) ([]string, error) {
+	files, err := r.Reader.Files(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, name := range files {
+		base, ok := strings.CutSuffix(name, ".up.sql")
+		if !ok {
+			continue
+		}
+
+		if version, title, ok := migrationName(base); ok {
+			paths = append(paths, version+"-"+title+".sql")
+		}
+	}
+
+	return paths, nil
+}
+
+// Read the golang-migrate "up" and "down" files for the drawbridge migration, combined
+// into a single migration file.
+func (r *GolangMigrateReader) Read(filename string) (io.Reader, error) {
+	directory, name := path.Split(filename)
+
+	version, title, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid migration filename: %s", filename)
+	}
+
+	up, err := readAll(r.Reader, Join(directory, version+"_"+title+".up.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	down, err := readAll(r.Reader, Join(directory, version+"_"+title+".down.sql"))
+	if errors.Is(err, fs.ErrNotExist) {
+		down = []byte("-- no down migration\n")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString("--- !Up\n")
+	b.Write(up)
+	b.WriteString("\n--- !Down\n")
+	b.Write(down)
+	b.WriteString("\n")
+
+	return &b, nil
+}
+
+// ImportGolangMigrate records the migrations golang-migrate applied to the database as
+// applied in the metadata table, without running them, so a service may switch from
+// golang-migrate to drawbridge.  Reads the version from golang-migrate's version table,
+// e.g. GolangMigrateTable, and records every migration up to and including that version,
+// so the options should read the migrations through a GolangMigrateReader.
+//
+// Returns ErrDirtyImport if golang-migrate's version is dirty, and ErrMetadataNotEmpty if
+// any migrations are already recorded in the metadata table, unless the options are
+// forced with WithForce.  On SQLite, which has no schemas, the metadata table must have
+// a different name than golang-migrate's table.
+func (options Options) ImportGolangMigrate(ctx context.Context, span Span, table string) error {
+	var version int
+	var dirty bool
+
+	// golang-migrate leaves the table empty if every migration was rolled back
+	row := span.QueryRowMigration(ctx, "select version, dirty from "+table+" limit 1")
+	if err := row.Scan(&version, &dirty); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("unable to read the golang-migrate version from %s: %w", table, err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%w: version %d", ErrDirtyImport, version)
+	}
+
+	err := options.markApplied(ctx, span, func(rev int) bool {
+		return rev <= version
+	})
+	if err != nil {
+		return fmt.Errorf("unable to import golang-migrate version %d: %w", version, err)
+	}
+
+	return nil
+}
+
+// Splits the base of a golang-migrate or goose migration filename, e.g.
+// `0001_create_users`, into its version and title.  The version must be a number.
+func migrationName(base string) (string, string, bool) {
+	version, title, ok := strings.Cut(base, "_")
+	if !ok || version == "" || strings.Trim(version, "0123456789") != "" {
+		return "", "", false
+	}
+
+	return version, title, true
+}
+
+// Reads the entire file, closing it if necessary.
+func readAll(reader Reader, path string) ([]byte, error) {
+	f, err := reader.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
+	}
+
+	return io.ReadAll(f)
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GoMigration is a migration written in Go, for changes that need application logic,
+// such as re-hashing passwords or splitting JSON into columns.  Register Go migrations
+// with WithGoMigrations; they're applied in revision order alongside the SQL migration
+// files, in a transaction with the metadata table locked, just like a SQL migration.
+//
+// Because the Down function can't be stored in the metadata table, a Go migration with a
+// Down function may only be rolled back while it's registered.  A Go migration without a
+// Down function is rolled back by simply removing it from the metadata table.
+type GoMigration struct {
+	// Revision orders the migration among the SQL migration files.
+	Revision int
+
+	// Name describes the migration, e.g. "backfill-emails".
+	Name string
+
+	// Up applies the migration.
+	Up func(ctx context.Context, tx Span) error
+
+	// Down rolls back the migration.  Optional.
+	Down func(ctx context.Context, tx Span) error
+
+	// The Source the migration belongs to, if any
+	source string
+}
+
+// Filename returns the name recorded for the migration in the metadata table, e.g.
+// `3-backfill-emails.go`, namespaced by its source if it belongs to a Source.
+func (gm GoMigration) Filename() string {
+	return namespaced(gm.source, fmt.Sprintf("%d-%s.go", gm.Revision, gm.Name))
+}
+
+// Applies or rolls back the Go migration in the transaction, and records it in the
+// metadata table.
+func (m Migration) applyGo(ctx context.Context, tx Span, gm GoMigration) error {
+	filename := gm.Filename()
+
+	fn := gm.Up
+	if m.direction == Down {
+		fn = gm.Down
+	}
+
+	start := time.Now()
+
+	if fn != nil {
+		if err := fn(ctx, tx); err != nil {
+			return fmt.Errorf("migration %s (%s) failed: %w", filename, m.direction, err)
+		}
+	}
+
+	if m.direction == Down {
+		return tx.ExecMigration(ctx, "delete from "+m.metadataTable+" where migration = $1", filename)
+	}
+
+	if err := goMigrated(ctx, tx, m.metadataTable, gm, m.rollbacks); err != nil {
+		return err
+	}
+
+	return RecordRun(ctx, tx, m.metadataTable, filename, time.Since(start), m.appliedBy, m.env)
+}
+
+// Records the Go migration as applied in the metadata table.
+func goMigrated(ctx context.Context, span Span, metadataTable string, gm GoMigration, rollbacks bool) error {
+	filename := gm.Filename()
+
+	if err := span.ExecMigration(ctx, "insert into "+metadataTable+" (migration) values ($1)", filename); err != nil {
+		return err
+	}
+
+	// With nothing to roll back, an empty embedded rollback lets the migration be
+	// rolled back after it's no longer registered
+	if rollbacks && gm.Down == nil {
+		return span.ExecMigration(ctx, "update "+metadataTable+" set rollback = '' where migration = $1", filename)
+	}
+
+	return nil
+}
+
+// Returns the SQL migration files and the Go migrations in order.  If direction is Down,
+// returns the migrations in reverse order.
+func (options Options) available(direction Direction) ([]string, error) {
+	filenames, err := Available(options.Reader, options.Directory, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.GoMigrations) == 0 {
+		return filenames, nil
+	}
+
+	for _, gm := range options.GoMigrations {
+		filenames = append(filenames, gm.Filename())
+	}
+
+	if direction == Down {
+		sort.Sort(SortDown(filenames))
+	} else {
+		sort.Sort(SortUp(filenames))
+	}
+
+	return filenames, nil
+}
+
+// Returns the latest revision of the SQL migration files and the Go migrations.
+func (options Options) latestRevision() int {
+	latest := LatestRevision(options.Reader, options.Directory)
+
+	for _, gm := range options.GoMigrations {
+		if gm.Revision > latest {
+			latest = gm.Revision
+		}
+	}
+
+	return latest
+}
+
+// Returns the Go migrations mapped by filename.
+func (options Options) goMigrations() map[string]GoMigration {
+	registered := make(map[string]GoMigration, len(options.GoMigrations))
+	for _, gm := range options.GoMigrations {
+		registered[gm.Filename()] = gm
+	}
+
+	return registered
+}
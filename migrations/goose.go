@@ -0,0 +1,177 @@
+package migrations
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// GooseTable is the default name of goose's version table.
+const GooseTable = "goose_db_version"
+
+// Matches goose's annotations, e.g. `-- +goose Up`
+var gooseRe = regexp.MustCompile(`^--\s*\+goose\s+(.*)$`)
+
+// GooseReader wraps a Reader to read a directory of goose SQL migrations, e.g.
+// `00001_create_users.sql`, as drawbridge migrations named with a dash, e.g.
+// `00001-create_users.sql`:
+//
+//	reader := migrations.FromGoose(new(migrations.DiskReader))
+//	options := migrations.WithDirectory("db/migrations").WithReader(reader)
+//
+// The `-- +goose Up` and `-- +goose Down` annotations become the `--- !Up` and
+// `--- !Down` sections, and `-- +goose NO TRANSACTION` marks both sections `notx`.  The
+// `-- +goose StatementBegin` and `-- +goose StatementEnd` annotations are left as
+// comments; when splitting statements, Split keeps dollar-quoted function bodies and
+// trigger blocks together on its own.  Goose's Go migrations aren't read; register them
+// with WithGoMigrations instead.
+type GooseReader struct {
+	Reader Reader
+}
+
+// FromGoose returns a [Reader] for the goose migrations read by the reader.
+func FromGoose(reader Reader) *GooseReader {
+	return &GooseReader{Reader: reader}
+}
+
+// Files returns a drawbridge migration filename for each goose SQL migration in the
+// directory.  Files that aren't goose SQL migrations are ignored.
+func (r *GooseReader) Files(directory string) ([]string, error) {
+	files, err := r.Reader.Files(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, name := range files {
+		base, ok := strings.CutSuffix(name, ".sql")
+		if !ok {
+			continue
+		}
+
+		if version, title, ok := migrationName(base); ok {
+			paths = append(paths, version+"-"+title+".sql")
+		}
+	}
+
+	return paths, nil
+}
+
+// Read the goose migration file for the drawbridge migration, with its annotations
+// translated into drawbridge sections.
+func (r *GooseReader) Read(filename string) (io.Reader, error) {
+	directory, name := path.Split(filename)
+
+	version, title, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid migration filename: %s", filename)
+	}
+
+	data, err := readAll(r.Reader, Join(directory, version+"_"+title+".sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The NO TRANSACTION annotation may appear anywhere, but applies to both sections
+	var modifiers string
+	for _, line := range strings.Split(string(data), "\n") {
+		if annotation(line) == "no transaction" {
+			modifiers = " /notx"
+		}
+	}
+
+	var b bytes.Buffer
+	var hasDown bool
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+
+		// Keep the annotation after the section header, so the section isn't empty
+		switch annotation(line) {
+		case "up":
+			b.WriteString("--- !Up" + modifiers + "\n")
+		case "down":
+			b.WriteString("--- !Down" + modifiers + "\n")
+			hasDown = true
+		}
+
+		b.WriteString(line + "\n")
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if !hasDown {
+		b.WriteString("--- !Down" + modifiers + "\n-- no down migration\n")
+	}
+
+	return &b, nil
+}
+
+// ImportGoose records the migrations goose applied to the database as applied in the
+// metadata table, without running them, so a service may switch from goose to drawbridge.
+// Reads the applied versions from goose's version table, e.g. GooseTable, including any
+// applied out of order, so the options should read the migrations through a GooseReader.
+//
+// Returns ErrMetadataNotEmpty if any migrations are already recorded in the metadata
+// table, unless the options are forced with WithForce.
+func (options Options) ImportGoose(ctx context.Context, span Span, table string) error {
+	applied, err := gooseVersions(ctx, span, table)
+	if err != nil {
+		return fmt.Errorf("unable to read the goose versions from %s: %w", table, err)
+	}
+
+	err = options.markApplied(ctx, span, func(rev int) bool {
+		return applied[rev]
+	})
+	if err != nil {
+		return fmt.Errorf("unable to import goose versions: %w", err)
+	}
+
+	return nil
+}
+
+// Returns the versions in goose's version table, and whether each is currently applied.
+func gooseVersions(ctx context.Context, span Span, table string) (map[int]bool, error) {
+	rows, err := span.QueryMigration(ctx, "select version_id, is_applied from "+table+" order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	// Goose records each migration and rollback, so the last record for a version wins
+	applied := make(map[int]bool)
+
+	for rows.Next() {
+		var version int
+		var isApplied bool
+
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, err
+		}
+
+		applied[version] = isApplied
+	}
+
+	return applied, rows.Err()
+}
+
+// Returns the goose annotation on the line in lowercase, e.g. "up" for `-- +goose Up`, or
+// a blank string if the line isn't an annotation.
+func annotation(line string) string {
+	found := gooseRe.FindStringSubmatch(strings.TrimSpace(line))
+	if len(found) < 2 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(found[1]))
+}
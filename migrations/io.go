@@ -1,8 +1,13 @@
 package migrations
 
 import (
+	"bytes"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 // Reader interface allows the migrations to be read from different sources,
@@ -37,3 +42,70 @@ func (disk *DiskReader) Files(directory string) ([]string, error) {
 func (disk *DiskReader) Read(path string) (io.Reader, error) {
 	return os.Open(path)
 }
+
+// FSReader reads the migrations from an [fs.FS], such as an [embed.FS], a [zip.Reader],
+// or an [fstest.MapFS].  This allows the SQL migrations to be compiled into the
+// application binary:
+//
+//	//go:embed sql/*.sql
+//	var sqlFiles embed.FS
+//
+//	options := migrations.WithDirectory("sql").WithReader(migrations.FromFS(sqlFiles))
+//
+// Paths in an [fs.FS] are always slash-separated and unrooted, so directories like
+// "./sql" are cleaned to "sql" before they are read.
+type FSReader struct {
+	FS fs.FS
+}
+
+// FromFS returns a [Reader] for the migrations in the file system.
+func FromFS(fsys fs.FS) *FSReader {
+	return &FSReader{FS: fsys}
+}
+
+// Files reads the filenames from the file system.
+func (r *FSReader) Files(directory string) ([]string, error) {
+	files, err := fs.ReadDir(r.FS, fsPath(directory))
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, info := range files {
+		if info.IsDir() {
+			continue
+		}
+
+		paths = append(paths, info.Name())
+	}
+
+	return paths, nil
+}
+
+// Read the SQL migration from the file system.
+func (r *FSReader) Read(path string) (io.Reader, error) {
+	data, err := fs.ReadFile(r.FS, fsPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// Converts a directory or file path into a path valid in an [fs.FS].
+func fsPath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	name = strings.TrimPrefix(name, "/")
+
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
+
+// Join the migrations directory and a migration filename.  Uses forward slashes, which
+// work for both [fs.FS] paths and the operating system.
+func Join(directory, filename string) string {
+	return path.Join(filepath.ToSlash(directory), filename)
+}
@@ -0,0 +1,201 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrLegacyUnsupported returned by AdoptLegacy if the Span doesn't implement
+// MetadataInspector, so it can't look for the legacy metadata tables.
+var ErrLegacyUnsupported = errors.New("the database span can't look for legacy metadata tables")
+
+// DefaultLegacyTables are the metadata tables used by earlier versions of the migrations
+// package, github.com/sbowman/migrations:  `migrations.applied` in v2 and
+// `public.schema_migrations` in v1.
+var DefaultLegacyTables = []string{"migrations.applied", "public.schema_migrations"}
+
+// MetadataInspector is implemented by a Span that can list the columns of a table, so
+// Apply can look for a legacy metadata table to adopt.  The postgres, postgres/std,
+// sqlite, and mysql spans implement it.
+type MetadataInspector interface {
+	// MetadataColumns returns the names of the table's columns, or nil if the table
+	// doesn't exist.
+	MetadataColumns(ctx context.Context, schema, table string) ([]string, error)
+}
+
+// LegacyReport describes the legacy metadata table adopted by AdoptLegacy.  If no legacy
+// table was adopted, the Table is blank.
+type LegacyReport struct {
+	// Table is the legacy metadata table the migrations were copied from.
+	Table string
+
+	// Migrations is the number of migrations copied into the metadata table.
+	Migrations int
+
+	// Rollbacks is the number of copied migrations with embedded rollbacks.
+	Rollbacks int
+}
+
+// String describes what was adopted.
+func (r LegacyReport) String() string {
+	if r.Table == "" {
+		return "no legacy metadata table adopted"
+	}
+
+	return fmt.Sprintf("adopted %d migrations, %d with embedded rollbacks, from %s", r.Migrations, r.Rollbacks, r.Table)
+}
+
+// AdoptLegacy copies the migrations and their embedded rollbacks from the first of the
+// options' LegacyTables found in the database into the metadata table, so an application
+// upgraded from github.com/sbowman/migrations doesn't apply its migrations again.  Apply
+// does this automatically, logging the report; call AdoptLegacy to adopt the table
+// without applying any migrations.
+//
+// Only adopts into an empty metadata table, so it runs once.  The legacy table is left in
+// place, and may be dropped once the application is upgraded.  Returns
+// ErrLegacyUnsupported if the options list LegacyTables, but the Span doesn't implement
+// MetadataInspector; Apply logs a warning instead.
+func (options Options) AdoptLegacy(ctx context.Context, span Span) (LegacyReport, error) {
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return LegacyReport{}, err
+	}
+
+	unlock, err := options.advisoryLock(ctx, span, metadataTable)
+	if err != nil {
+		return LegacyReport{}, err
+	}
+	defer func() {
+		_ = unlock(ctx)
+	}()
+
+	return options.adoptLegacy(ctx, span, metadataTable)
+}
+
+// Copies the first legacy metadata table found into the empty metadata table.  Once the
+// metadata table has migrations, returns without locking it or looking for the legacy
+// tables.
+func (options Options) adoptLegacy(ctx context.Context, span Span, metadataTable string) (LegacyReport, error) {
+	if len(options.LegacyTables) == 0 {
+		return LegacyReport{}, nil
+	}
+
+	if empty, err := emptyMetadata(ctx, span, metadataTable); err != nil || !empty {
+		return LegacyReport{}, err
+	}
+
+	inspector, ok := span.(MetadataInspector)
+	if !ok {
+		return LegacyReport{}, ErrLegacyUnsupported
+	}
+
+	tx, err := Begin(ctx, span)
+	if err != nil {
+		return LegacyReport{}, err
+	}
+	defer TxClose(ctx, tx)
+
+	if options.Locking != LockAdvisory {
+		if err := lockMetadata(ctx, tx, metadataTable, options.LockWait); err != nil {
+			return LegacyReport{}, err
+		}
+		defer tx.UnlockMetadata(ctx, metadataTable)
+	}
+
+	// Another process may have adopted the legacy table while we waited for the lock
+	if empty, err := emptyMetadata(ctx, tx, metadataTable); err != nil || !empty {
+		return LegacyReport{}, err
+	}
+
+	for _, legacy := range options.LegacyTables {
+		legacySchema, legacyTable := splitSchemaTable(legacy)
+		if legacySchema+"."+legacyTable == options.MetadataTable.Schema+"."+options.MetadataTable.Name {
+			continue
+		}
+
+		columns, err := inspector.MetadataColumns(ctx, legacySchema, legacyTable)
+		if err != nil {
+			return LegacyReport{}, err
+		}
+
+		if !slices.Contains(columns, "migration") {
+			continue
+		}
+
+		report, err := copyLegacy(ctx, tx, metadataTable, legacySchema+"."+legacyTable, slices.Contains(columns, "rollback"))
+		if err != nil {
+			return LegacyReport{}, fmt.Errorf("unable to adopt legacy metadata table %s: %w", legacy, err)
+		}
+
+		if err := tx.CommitMigration(ctx); err != nil {
+			return LegacyReport{}, err
+		}
+
+		return report, nil
+	}
+
+	return LegacyReport{}, nil
+}
+
+// Returns true if no migrations are recorded in the metadata table.
+func emptyMetadata(ctx context.Context, span Span, metadataTable string) (bool, error) {
+	var count int
+
+	row := span.QueryRowMigration(ctx, "select count(*) from "+metadataTable)
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
+// Copies the migrations, and their rollbacks if the legacy table has them, into the
+// metadata table.  The copied migrations have no checksum or applied time, as the
+// legacy table didn't track them.
+func copyLegacy(ctx context.Context, tx Span, metadataTable, legacyTable string, rollbacks bool) (LegacyReport, error) {
+	rollback := "null"
+	if rollbacks {
+		rollback = "rollback"
+	}
+
+	err := tx.ExecMigration(ctx, "insert into "+metadataTable+" (migration, rollback, applied_at) "+
+		"select migration, "+rollback+", null from "+legacyTable)
+	if err != nil {
+		return LegacyReport{}, err
+	}
+
+	report := LegacyReport{Table: legacyTable}
+
+	row := tx.QueryRowMigration(ctx, "select count(*), count(rollback) from "+metadataTable)
+	if err := row.Scan(&report.Migrations, &report.Rollbacks); err != nil {
+		return LegacyReport{}, err
+	}
+
+	return report, nil
+}
+
+// Logs the legacy metadata table adopted, if any.
+func (options Options) logLegacy(report LegacyReport) {
+	if report.Table == "" {
+		return
+	}
+
+	options.logger().Info("adopted legacy metadata table", "table", report.Table,
+		"migrations", report.Migrations, "rollbacks", report.Rollbacks)
+}
+
+// Splits a "schema.table" name into its schema and table.  Without a schema, defaults to
+// the "public" schema, as in WithSchemaTable.
+func splitSchemaTable(schemaTable string) (string, string) {
+	if schema, table, ok := strings.Cut(schemaTable, "."); ok {
+		return schema, table
+	}
+
+	return "public", schemaTable
+}
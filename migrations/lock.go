@@ -0,0 +1,158 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// LockMode selects how Apply prevents multiple processes from applying migrations
+// simultaneously.
+type LockMode string
+
+const (
+	// LockTable locks the metadata table in each migration's transaction, using the
+	// Span's LockMetadata.  This is the default.
+	LockTable LockMode = "table"
+
+	// LockAdvisory holds an advisory lock for the entire Apply run, using a Span that
+	// implements AdvisoryLocker.  The metadata table isn't locked, so other processes
+	// may read it, e.g. to call AtLatest in a health check.
+	LockAdvisory LockMode = "advisory"
+)
+
+// How often to retry acquiring an advisory lock held by another process.
+const lockPollInterval = 250 * time.Millisecond
+
+var (
+	// ErrLockTimeout returned if the advisory lock couldn't be acquired before the
+	// lock wait expired.  See LockTimeoutError for the process holding the lock.
+	ErrLockTimeout = errors.New("timed out waiting for the migrations lock")
+
+	// ErrAdvisoryLockUnsupported returned if the options use LockAdvisory, but the Span
+	// doesn't implement AdvisoryLocker.
+	ErrAdvisoryLockUnsupported = errors.New("advisory locks are not supported by the database span")
+)
+
+// AdvisoryLocker is implemented by a Span that supports holding an advisory lock for the
+// entire Apply run, such as PostgreSQL's pg_advisory_lock.
+type AdvisoryLocker interface {
+	// AdvisoryLock acquires the advisory lock for the metadata table, waiting up to
+	// `wait` for another process to release it, or indefinitely if `wait` is zero.
+	// Returns a function to release the lock.  If the wait expires, returns a
+	// LockTimeoutError.
+	AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (unlock func(ctx context.Context) error, err error)
+}
+
+// MetadataLockWaiter is implemented by a Span that polls for its metadata lock, such as
+// MySQL's GET_LOCK, so the wait for another process to release it may be limited.  With
+// LockTable, the metadata table is locked with LockMetadataWait and the options' LockWait
+// rather than LockMetadata.
+type MetadataLockWaiter interface {
+	// LockMetadataWait locks the metadata table like LockMetadata, waiting up to `wait`
+	// for another process to release it, or indefinitely if `wait` is zero.  If the wait
+	// expires, returns a LockTimeoutError.
+	LockMetadataWait(ctx context.Context, metadataTable string, wait time.Duration) error
+}
+
+// LockTimeoutError identifies the process holding the advisory lock when the wait for
+// it expired.  The details of the process may be blank if the database couldn't report
+// them.  errors.Is(err, ErrLockTimeout) returns true for a LockTimeoutError.
+type LockTimeoutError struct {
+	// Wait is how long we waited for the lock.
+	Wait time.Duration
+
+	// PID is the process ID of the database connection holding the lock.
+	PID int
+
+	// ApplicationName is the application name of the connection holding the lock.
+	ApplicationName string
+
+	// ClientAddr is the client address of the connection holding the lock.
+	ClientAddr string
+}
+
+// Error describes the process holding the lock.
+func (e *LockTimeoutError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s after %s", ErrLockTimeout, e.Wait)
+	}
+
+	return fmt.Sprintf("%s after %s; held by pid %d (application_name %q, client_addr %q)",
+		ErrLockTimeout, e.Wait, e.PID, e.ApplicationName, e.ClientAddr)
+}
+
+// Is matches ErrLockTimeout.
+func (e *LockTimeoutError) Is(target error) bool {
+	return target == ErrLockTimeout
+}
+
+// Locks the metadata table in the transaction, waiting up to `wait` if the Span
+// implements MetadataLockWaiter.
+func lockMetadata(ctx context.Context, tx Span, metadataTable string, wait time.Duration) error {
+	if waiter, ok := tx.(MetadataLockWaiter); ok {
+		return waiter.LockMetadataWait(ctx, metadataTable, wait)
+	}
+
+	return tx.LockMetadata(ctx, metadataTable)
+}
+
+// AdvisoryLockKey returns the 64-bit advisory lock key for the metadata table, so every
+// process applying migrations to the same metadata table uses the same lock.
+func AdvisoryLockKey(metadataTable string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("drawbridge:" + metadataTable))
+	return int64(h.Sum64())
+}
+
+// PollLock calls `try` until it acquires the lock, waiting up to `wait`, or indefinitely
+// if `wait` is zero.  Returns ErrLockTimeout if the wait expires.  For use by
+// AdvisoryLocker implementations.
+func PollLock(ctx context.Context, wait time.Duration, try func(ctx context.Context) (bool, error)) error {
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		locked, err := try(ctx)
+		if err != nil {
+			return err
+		}
+
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return ErrLockTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// Acquires the advisory lock if the options call for it.  Returns a function to release
+// the lock, which does nothing if the lock mode is LockTable.
+func (options Options) advisoryLock(ctx context.Context, span Span, metadataTable string) (func(ctx context.Context) error, error) {
+	if options.Locking != LockAdvisory {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	locker, ok := span.(AdvisoryLocker)
+	if !ok {
+		return nil, ErrAdvisoryLockUnsupported
+	}
+
+	return locker.AdvisoryLock(ctx, metadataTable, options.LockWait)
+}
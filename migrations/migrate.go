@@ -7,13 +7,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/sbowman/drawbridge"
+	"time"
 )
 
 // Direction is the direction to migrate
@@ -34,8 +37,12 @@ const (
 )
 
 var (
-	// ErrInvalidSpan returned if the [drawbridge.Span] used to create a transaction
-	// isn't compatible with [migrations.Span].
+	// ErrInvalidSpan returned if the [drawbridge.Span] passed to FromSpan isn't
+	// compatible with [migrations.Span].
+	//
+	// Deprecated: migrations.Span no longer embeds drawbridge.Span, so the migrations
+	// functions accept a Span directly and never return ErrInvalidSpan.  Only FromSpan,
+	// for code still holding a drawbridge.Span, returns it.
 	ErrInvalidSpan = errors.New("does not implement migrations.Span interface")
 
 	// ErrNameRequired returned if the user failed to supply a name for the
@@ -58,49 +65,16 @@ var (
 	// previous version.
 	ErrRollbackRequired = errors.New("rollback required")
 
-	// Matches the Up/Down sections in the SQL migration file
-	dirRe = regexp.MustCompile(`^---\s+!(Up|Down).*$`)
+	// Matches the Up/Down sections in the SQL migration file, along with any modifiers
+	dirRe = regexp.MustCompile(`^---\s+!(Up|Down)\b(.*)$`)
 )
 
-// Span extends the drawbridge.Span interface to support database migrations.
-type Span interface {
-	drawbridge.Span
-
-	// CreateMetadata verifies if the schema and table exists, and if they don't, it
-	// creates them.  Returns the name to use for the database queries related to
-	// the migrations.  For example, if the schema is `drawbridge` and the table is
-	// `schema_migrations`, CreateMetadata would return `drawbridge.schema_migrations`.
-	//
-	//
-	CreateMetadata(ctx context.Context, schema, table string) (string, error)
-
-	// LockMetadata locks the migrations package's metadata table to prevent other
-	// processes from applying migrations.
-	LockMetadata(ctx context.Context, metadataTable string) error
-
-	// UnlockMetadata unlocks the migrations package's metadata table.  Some databases
-	// require an unlock, whereas other databases unlock the table at the end of the
-	// transaction, so this may do nothing.
-	UnlockMetadata(ctx context.Context, metadataTable string)
-}
-
-// Begin is a helper function to create a transaction compatible with a [migration.Span]
-// from a [drawbridge.Span]
-func Begin(ctx context.Context, span drawbridge.Span) (Span, error) {
-	tx, err := span.Begin(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	stx, ok := tx.(Span)
-	if !ok {
-		return nil, ErrInvalidSpan
-	}
-
-	return stx, nil
-}
-
 // Create a new migration from the template.  Returns the full path to the created file.
+//
+// The revision is the next revision after the migrations visible to the options' Reader,
+// or the current time if using timestamps.  The file is always written to the Directory
+// on disk.  When using an FSReader, this means
+// the Directory should point to the source directory of the embedded files.
 func (options Options) Create(name string) (string, error) {
 	trimmed := strings.TrimSpace(name)
 	if trimmed == "" {
@@ -111,9 +85,8 @@ func (options Options) Create(name string) (string, error) {
 		return "", err
 	}
 
-	r := LatestRevision(options.Reader, options.Directory) + 1
-	fullname := fmt.Sprintf("%d-%s.sql", r, trimmed)
-	path := fmt.Sprintf("%s%c%s", options.Directory, os.PathSeparator, fullname)
+	fullname := fmt.Sprintf("%s-%s.sql", options.nextRevision(), trimmed)
+	path := filepath.Join(options.Directory, fullname)
 
 	if err := os.WriteFile(path, []byte("--- !Up\n\n--- !Down\n\n"), 0644); err != nil {
 		return "", err
@@ -125,13 +98,19 @@ func (options Options) Create(name string) (string, error) {
 // AtLatest returns nil if the database has been migrated to the latest revision, as
 // indicated by the SQL file versions.  If there are new migrations yet to be applied,
 // returns ErrMigrateRequired.  If the database is ahead of the current revision, e.g.
-// the app was downgraded, returns ErrRollbackRequired.
+// the app was downgraded, returns ErrRollbackRequired.  Also returns ErrMigrateRequired
+// if any repeatable migrations have changed.  If checksums are verified and
+// applied migrations were modified, returns a ChecksumError.
 //
 // You can use this function on your application's startup to let the user know if a
 // migration is required or not, without automatically applying a migration.  This
 // function does not modify the database in any way.
 func (options Options) AtLatest(ctx context.Context, span Span) error {
-	available := LatestRevision(options.Reader, options.Directory)
+	if len(options.Sources) > 0 {
+		return options.sourcesAtLatest(ctx, span)
+	}
+
+	available := options.latestRevision()
 
 	schema := options.MetadataTable.Schema
 	table := options.MetadataTable.Name
@@ -141,17 +120,30 @@ func (options Options) AtLatest(ctx context.Context, span Span) error {
 		return err
 	}
 
-	latestMigration, err := LatestMigration(ctx, span, metadataTable)
+	if err := options.checkChecksums(ctx, span, metadataTable); err != nil {
+		return err
+	}
+
+	latest, err := latestMigration(ctx, span, metadataTable, options.source)
 	if err != nil {
 		return err
 	}
 
-	applied, err := Revision(latestMigration)
+	applied, err := Revision(latest)
 	if err != nil {
 		return err
 	}
 
 	if applied == available {
+		pending, err := options.pendingRepeatables(ctx, span, metadataTable)
+		if err != nil {
+			return err
+		}
+
+		if len(pending) > 0 {
+			return ErrMigrateRequired
+		}
+
 		return nil
 	}
 
@@ -172,11 +164,29 @@ func (options Options) AtLatest(ctx context.Context, span Span) error {
 //
 // If the migrations table does not exist, this function automatically creates it.
 //
+// When migrating to the latest revision, any repeatable migrations that changed are run
+// last, in order by name.  See RepeatablePrefix.
+//
 // May return an ErrStopped if rolling back migrations and the Down portion has a /stop
 // modifier.
 //
+// Returns a ChecksumError without applying any migrations if checksums are verified and
+// applied migrations were modified.
+//
+// If any Sources are configured, each source is migrated to its latest revision in turn,
+// instead of the migrations in the Directory, all recorded in the one metadata table.
+// Returns ErrSourceRevision if the Revision isn't Latest; see Source.
+//
+// If the metadata table is empty and a legacy metadata table from
+// github.com/sbowman/migrations is found, its migrations are adopted first; see
+// AdoptLegacy.
+//
 // Note `span` should be a database connection or pool, not a transaction.
 func (options Options) Apply(ctx context.Context, span Span) error {
+	if len(options.Sources) > 0 {
+		return options.applySources(ctx, span)
+	}
+
 	schema := options.MetadataTable.Schema
 	table := options.MetadataTable.Name
 
@@ -185,30 +195,86 @@ func (options Options) Apply(ctx context.Context, span Span) error {
 		return err
 	}
 
-	reader := options.Reader
+	unlock, err := options.advisoryLock(ctx, span, metadataTable)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock(ctx)
+	}()
+
+	report, err := options.adoptLegacy(ctx, span, metadataTable)
+	if errors.Is(err, ErrLegacyUnsupported) {
+		options.logger().Warn("not looking for a legacy metadata table to adopt", "error", err,
+			"tables", options.LegacyTables)
+	} else if err != nil {
+		return err
+	}
+
+	options.logLegacy(report)
+
+	if err := options.checkChecksums(ctx, span, metadataTable); err != nil {
+		return err
+	}
 
-	direction := Moving(ctx, span, metadataTable, options.Revision)
-	migrations, err := Available(reader, options.Directory, direction)
+	if err := options.checkDirty(ctx, span, metadataTable); err != nil {
+		return err
+	}
+
+	reader := options.reader()
+
+	direction := moving(ctx, span, metadataTable, options.source, options.Revision)
+	migrations, err := options.available(direction)
 	if err != nil {
 		return err
 	}
 
-	m := Migration{span, reader, metadataTable, direction, options.Revision, options.EmbeddedRollbacks}
+	if direction == Up {
+		if err := options.checkOutOfOrder(ctx, span, metadataTable, migrations); err != nil {
+			return err
+		}
+	}
+
+	m := Migration{
+		span:          span,
+		reader:        reader,
+		metadataTable: metadataTable,
+		direction:     direction,
+		revision:      options.Revision,
+		rollbacks:     options.EmbeddedRollbacks,
+		appliedBy:     options.AppliedBy,
+		split:         options.SplitStatements,
+		goMigrations:  options.goMigrations(),
+		advisory:      options.Locking == LockAdvisory,
+		lockWait:      options.LockWait,
+		source:        options.source,
+		logger:        options.Logger,
+		hook:          options.Hook,
+		searchPath:    options.SearchPath,
+		env:           options.Env,
+	}
 
 	for _, migration := range migrations {
-		path := fmt.Sprintf("%s%c%s", options.Directory, os.PathSeparator, migration)
+		path := Join(options.Directory, migration)
 		if err := m.ReadAndApply(ctx, path); err != nil {
 			return err
 		}
 	}
 
-	if !options.EmbeddedRollbacks {
+	if options.EmbeddedRollbacks {
+		// If the application was downgraded, we may need to rollback the migrations to
+		// the correct revision for this version of the application...
+		if err := m.HandleEmbeddedRollbacks(ctx, options.Directory); err != nil {
+			return err
+		}
+	}
+
+	// Repeatable migrations may depend on any of the versioned migrations
+	if options.Revision != Latest {
 		return nil
 	}
 
-	// If the application was downgraded, we may need to rollback the migrations to
-	// the correct revision for this version of the application...
-	return m.HandleEmbeddedRollbacks(ctx, options.Directory)
+	return m.ApplyRepeatables(ctx, options.Directory)
 }
 
 // Migration defines the details about the migration being attempted.
@@ -219,6 +285,20 @@ type Migration struct {
 	direction     Direction // direction to move to the revision
 	revision      int       // move to this revision
 	rollbacks     bool      // support embedded rollbacks?
+	appliedBy     string    // who is applying the migrations
+	split         bool      // run the SQL statement by statement?
+
+	goMigrations map[string]GoMigration // Go migrations by filename
+	advisory     bool                   // holding an advisory lock instead of locking the table
+	lockWait     time.Duration          // how long to wait for the migrations lock
+	exclusive    bool                   // holding the advisory lock for a non-transactional migration
+
+	logger *slog.Logger // logs the migration events, if set
+	hook   Hook         // called with the migration events, if set
+
+	searchPath []string // PostgreSQL search path set in each transaction, if any
+	env        string   // the environment recorded with each migration
+	source     string   // the Source whose migrations are namespaced in the metadata table
 }
 
 // TODO: function to check the database version and the latest SQL revision and warn if not up to date!
@@ -227,43 +307,208 @@ type Migration struct {
 // SQL for the direction, provided the revision is correct, all in a single transaction.
 //
 // Each migration file, when applied, is done so in a transaction with the metadata table
-// locked, to prevent duplicate migrations across processes.
+// locked, to prevent duplicate migrations across processes, unless an advisory lock is
+// held for the entire Apply run (see LockAdvisory).  If the section has the
+// `notx` modifier, the SQL is run outside the transaction; see applyNoTx.
+//
+// Non-transactional migrations hold the advisory lock for the metadata table while their
+// SQL runs, if the Span implements AdvisoryLocker.  A migration finding another process's
+// non-transactional migration marked dirty waits for the lock, then checks again.
+//
+// If the section sets a `lock_timeout` or `statement_timeout`, they're set in the
+// transaction before running the SQL, or ErrTimeoutsUnsupported is returned if the Span
+// doesn't implement TimeoutSetter.  If the section allows `retries`, and the migration
+// fails because the lock timeout expired, the entire transaction is retried after an
+// increasing delay.  Non-transactional sections ignore these modifiers.
+//
+// Returns a DirtyError if a non-transactional migration previously failed partway.
 func (m Migration) ReadAndApply(ctx context.Context, path string) error {
-	tx, err := Begin(ctx, m.span)
+	var section Section
+
+	if _, ok := m.goMigrations[Filename(path)]; !ok {
+		var err error
+		if section, err = ReadSection(m.reader, path, m.direction, m.env); err != nil {
+			return err
+		}
+	}
+
+	if section.NoTx {
+		return m.exclusively(ctx, func(m Migration) error {
+			return m.readAndApply(ctx, path, section)
+		})
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.readAndApply(ctx, path, section)
+
+		var dirty *DirtyError
+		if errors.As(err, &dirty) && m.canWait() {
+			// Another process may still be applying the dirty migration
+			err = m.exclusively(ctx, func(m Migration) error {
+				return m.readAndApply(ctx, path, section)
+			})
+		}
+
+		if err == nil || section.NoTx || attempt >= section.Retries || !lockNotAvailable(err) {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		m.warnings().Warn("migration timed out waiting for a lock, retrying", AttrMigration, Filename(path),
+			"attempt", attempt+1, "retries", section.Retries, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Applies the migration in a single transaction, as described by ReadAndApply.
+func (m Migration) readAndApply(ctx context.Context, path string, section Section) error {
+	tx, err := m.begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer drawbridge.TxClose(ctx, tx)
+	defer TxClose(ctx, tx)
 
-	if err := tx.LockMetadata(ctx, m.metadataTable); err != nil {
+	if !m.advisory {
+		if err := lockMetadata(ctx, tx, m.metadataTable, m.lockWait); err != nil {
+			return err
+		}
+		defer tx.UnlockMetadata(ctx, m.metadataTable)
+	}
+
+	if err := CheckDirty(ctx, tx, m.metadataTable); err != nil {
 		return err
 	}
-	defer tx.UnlockMetadata(ctx, m.metadataTable)
 
-	if ShouldRun(ctx, tx, m.metadataTable, path, m.direction, m.revision) {
-		SQL, err := ReadSQL(m.reader, path, m.direction)
-		if err != nil {
+	if !ShouldRun(ctx, tx, m.metadataTable, path, m.direction, m.revision) {
+		return tx.CommitMigration(ctx)
+	}
+
+	event := Event{Migration: Filename(path), Direction: m.direction}
+	start := time.Now()
+
+	m.emit(ctx, event.with(EventStart, 0, nil))
+
+	if err := m.apply(ctx, tx, path, section); err != nil {
+		m.emit(ctx, event.with(EventFailure, time.Since(start), err))
+		return err
+	}
+
+	m.emit(ctx, event.with(EventFinish, time.Since(start), nil))
+	return nil
+}
+
+// Applies the migration in the transaction and commits it.
+func (m Migration) apply(ctx context.Context, tx Span, path string, section Section) error {
+	if gm, ok := m.goMigrations[Filename(path)]; ok {
+		if err := m.applyGo(ctx, tx, gm); err != nil {
 			return err
 		}
 
-		_, err = tx.Exec(ctx, SQL)
-		if err != nil {
-			// fmt.Errorf isn't my favorite, but we need the migration name
-			return fmt.Errorf("migration %s (%s) failed: %w", path, m.direction, err)
+		return tx.CommitMigration(ctx)
+	}
+
+	if m.direction == Down && section.Stop {
+		return &StoppedError{Migration: Filename(path)}
+	}
+
+	if m.direction == Up {
+		if recorded, err := m.applySquashed(ctx, tx, path); err != nil {
+			return err
+		} else if recorded {
+			return tx.CommitMigration(ctx)
 		}
+	}
+
+	if section.NoTx {
+		return m.applyNoTx(ctx, tx, path)
+	}
 
-		if err = Migrated(ctx, tx, m.reader, m.metadataTable, path, m.direction, m.rollbacks); err != nil {
+	if err := setTimeouts(ctx, tx, section.LockTimeout, section.StatementTimeout); err != nil {
+		return fmt.Errorf("migration %s (%s) failed: %w", path, m.direction, err)
+	}
+
+	SQL, err := ReadSQL(m.reader, path, m.direction)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	if err := m.exec(ctx, tx, SQL); err != nil {
+		// fmt.Errorf isn't my favorite, but we need the migration name
+		return fmt.Errorf("migration %s (%s) failed: %w", path, m.direction, err)
+	}
+
+	if err = Migrated(ctx, tx, m.reader, m.metadataTable, path, m.direction, m.rollbacks); err != nil {
+		return err
+	}
+
+	if m.direction == Up {
+		if err := RecordRun(ctx, tx, m.metadataTable, path, time.Since(start), m.appliedBy, m.env); err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return tx.CommitMigration(ctx)
 }
 
-// Rollback a number of migrations.
+// Starts a transaction for a migration, with the search path set if there is one.
+func (m Migration) begin(ctx context.Context) (Span, error) {
+	tx, err := Begin(ctx, m.span)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.searchPath) == 0 {
+		return tx, nil
+	}
+
+	if err := tx.ExecMigration(ctx, "set local search_path to "+quoteIdentifiers(m.searchPath)); err != nil {
+		TxClose(ctx, tx)
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Runs the SQL in a single call, or statement by statement if splitting statements.
+// Does nothing if the SQL is only comments, e.g. a section skipped for the environment.
+func (m Migration) exec(ctx context.Context, span Span, SQL string) error {
+	if len(splitFor(span, SQL)) == 0 {
+		return nil
+	}
+
+	if m.split {
+		return execStatements(ctx, span, SQL)
+	}
+
+	return span.ExecMigration(ctx, SQL)
+}
+
+// Rollback a number of migrations.  Returns ErrSourceRevision if any Sources are
+// configured; see Source to roll back a single source.
 func (options Options) Rollback(ctx context.Context, span Span, steps int) error {
+	version, err := options.rollbackRevision(ctx, span, steps)
+	if err != nil {
+		return err
+	}
+
+	return options.WithRevision(version).Apply(ctx, span)
+}
+
+// Returns the revision to roll back to, given the number of steps to roll back.
+func (options Options) rollbackRevision(ctx context.Context, span Span, steps int) (int, error) {
 	if steps < 1 {
-		return ErrInvalidStep
+		return 0, ErrInvalidStep
+	}
+
+	if len(options.Sources) > 0 {
+		return 0, ErrSourceRevision
 	}
 
 	schema := options.MetadataTable.Schema
@@ -271,17 +516,17 @@ func (options Options) Rollback(ctx context.Context, span Span, steps int) error
 
 	metadataTable, err := span.CreateMetadata(ctx, schema, table)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	latest, err := LatestMigration(ctx, span, metadataTable)
+	latest, err := latestMigration(ctx, span, metadataTable, options.source)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	revision, err := Revision(latest)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	version := revision - steps
@@ -289,14 +534,15 @@ func (options Options) Rollback(ctx context.Context, span Span, steps int) error
 		version = 0
 	}
 
-	return options.WithRevision(version).Apply(ctx, span)
+	return version, nil
 }
 
 // Available returns the list of SQL migration paths in order.  If direction is
-// Down, returns the migrations in reverse order (migrating down).
+// Down, returns the migrations in reverse order (migrating down).  Repeatable migrations
+// aren't included; see Repeatables.
 func Available(reader Reader, directory string, direction Direction) ([]string, error) {
 	files, err := reader.Files(directory)
-	if os.IsNotExist(err) {
+	if errors.Is(err, fs.ErrNotExist) {
 		return nil, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("invalid migrations directory, %s: %s", directory, err.Error())
@@ -304,7 +550,7 @@ func Available(reader Reader, directory string, direction Direction) ([]string,
 
 	var filenames []string
 	for _, name := range files {
-		if strings.HasSuffix(name, ".sql") {
+		if strings.HasSuffix(name, ".sql") && !IsRepeatable(name) {
 			filenames = append(filenames, name)
 		}
 	}
@@ -343,13 +589,17 @@ func LatestRevision(reader Reader, directory string) int {
 	return 0
 }
 
-// Revision extracts the revision number from a migration filename.
+// Revision extracts the revision number from a migration filename.  The revision may be
+// a sequential number, e.g. `42-add-users.sql`, or a timestamp, e.g.
+// `20261016120000-add-users.sql`.  Timestamp revisions require a 64-bit platform.
 func Revision(filename string) (int, error) {
 	if filename == "" {
 		return 0, nil
 	}
 
-	segments := strings.SplitN(Filename(filename), "-", 2)
+	_, name := SplitNamespace(Filename(filename))
+
+	segments := strings.SplitN(name, "-", 2)
 	if len(segments) == 1 {
 		return 0, fmt.Errorf("invalid migration filename: %s", filename)
 	}
@@ -362,19 +612,26 @@ func Revision(filename string) (int, error) {
 	return v, nil
 }
 
-// Filename returns just the filename from the full path.
+// Filename returns just the filename from the full path.  Supports both slash-separated
+// paths, such as those from an [fs.FS], and paths using the operating system's separator.
 func Filename(path string) string {
-	paths := strings.Split(path, string(os.PathSeparator))
-	return paths[len(paths)-1]
+	path = filepath.ToSlash(path)
+	return path[strings.LastIndex(path, "/")+1:]
 }
 
-// Moving determines the direction we're moving to reach the version.
+// Moving determines the direction we're moving to reach the version.  Migrations
+// belonging to a Source are ignored.
 func Moving(ctx context.Context, span Span, metadataTable string, version int) Direction {
+	return moving(ctx, span, metadataTable, "", version)
+}
+
+// Determines the direction the source's migrations are moving to reach the version.
+func moving(ctx context.Context, span Span, metadataTable, source string, version int) Direction {
 	if version == Latest {
 		return Up
 	}
 
-	latest, err := LatestMigration(ctx, span, metadataTable)
+	latest, err := latestMigration(ctx, span, metadataTable, source)
 	if err != nil {
 		return None
 	}
@@ -429,7 +686,13 @@ func IsDown(version int, desired int) bool {
 func ReadSQL(reader Reader, path string, direction Direction) (string, error) {
 	f, err := reader.Read(path)
 	if err != nil {
-		return "", nil
+		return "", err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
 	}
 
 	sqldoc := new(bytes.Buffer)
@@ -463,12 +726,18 @@ func ReadSQL(reader Reader, path string, direction Direction) (string, error) {
 }
 
 // LatestMigration returns the name of the latest migration run against the database.
+// Migrations belonging to a Source are ignored.
 func LatestMigration(ctx context.Context, span Span, metadataTable string) (string, error) {
+	return latestMigration(ctx, span, metadataTable, "")
+}
+
+// Returns the name of the source's latest migration run against the database.
+func latestMigration(ctx context.Context, span Span, metadataTable, source string) (string, error) {
 	var latest, migration string
 
 	// PostgreSQL may not order the migrations by revision, so we need to compute which is
 	// latest
-	rows, err := span.Query(ctx, "select migration from "+metadataTable)
+	rows, err := span.QueryMigration(ctx, "select migration from "+metadataTable+" where squashed_by is null and not repeatable")
 	if err != nil {
 		return "", err
 	}
@@ -481,6 +750,10 @@ func LatestMigration(ctx context.Context, span Span, metadataTable string) (stri
 			return "", err
 		}
 
+		if !inSource(migration, source) {
+			continue
+		}
+
 		m, _ := Revision(migration)
 		l, _ := Revision(latest)
 
@@ -489,27 +762,43 @@ func LatestMigration(ctx context.Context, span Span, metadataTable string) (stri
 		}
 	}
 
-	return latest, nil
+	return latest, rows.Err()
+}
+
+// RecordRun records when the migration was applied, how long it took, who applied it, and
+// in what environment in the metadata table.
+func RecordRun(ctx context.Context, span Span, metadataTable, path string, duration time.Duration, appliedBy, env string) error {
+	return span.ExecMigration(ctx, "update "+metadataTable+" set applied_at = current_timestamp, duration_ms = $1, applied_by = $2, env = $3 where migration = $4",
+		duration.Milliseconds(), appliedBy, env, Filename(path))
 }
 
 // IsMigrated checks the migration has been applied to the database, i.e. is it
 // in the migrations.applied table?
 func IsMigrated(ctx context.Context, span Span, metadataTable string, migration string) bool {
 	// If migrating, table should be locked, so no need to lock the row
-	row := span.QueryRow(ctx, "select migration from "+metadataTable+" where migration = $1 limit 1", Filename(migration))
-	return !errors.Is(row.Scan(), sql.ErrNoRows)
+	var found string
+
+	row := span.QueryRowMigration(ctx, "select migration from "+metadataTable+" where migration = $1 limit 1", Filename(migration))
+	return !errors.Is(row.Scan(&found), sql.ErrNoRows)
 }
 
-// Migrated adds or removes the migration record from the metadata table.
+// Migrated adds or removes the migration record from the metadata table.  When adding
+// the record, includes the checksum of the "up" SQL.
 func Migrated(ctx context.Context, span Span, reader Reader, metadataTable, path string, direction Direction, rollbacks bool) error {
 	filename := Filename(path)
 
 	if direction == Down {
-		if _, err := span.Exec(ctx, "delete from "+metadataTable+" where migration = $1", filename); err != nil {
+		// Also clean out any migrations squashed into this one
+		if err := span.ExecMigration(ctx, "delete from "+metadataTable+" where migration = $1 or squashed_by = $1", filename); err != nil {
 			return err
 		}
 	} else {
-		if _, err := span.Exec(ctx, "insert into "+metadataTable+" (migration) values ($1)", filename); err != nil {
+		checksum, err := Checksum(reader, path)
+		if err != nil {
+			return err
+		}
+
+		if err := span.ExecMigration(ctx, "insert into "+metadataTable+" (migration, checksum) values ($1, $2)", filename, checksum); err != nil {
 			return err
 		}
 
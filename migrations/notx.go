@@ -0,0 +1,236 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDirty returned if a non-transactional migration failed partway, leaving the
+	// database in an unknown state.  The database must be repaired manually, then the
+	// dirty marker cleared with ClearDirty.  See DirtyError for the migrations.
+	ErrDirty = errors.New("migration failed partway and requires manual repair")
+
+	// ErrNoTxInTransaction returned if a non-transactional migration is applied using a
+	// Span that is a transaction.
+	ErrNoTxInTransaction = errors.New("non-transactional migration may not be applied in a transaction")
+
+	// ErrNoTxSearchPath returned if a non-transactional migration is applied with a
+	// search path, such as when migrating tenant schemas.  The search path is only set
+	// in each migration's transaction.
+	ErrNoTxSearchPath = errors.New("non-transactional migration may not be applied with a search path")
+)
+
+// DirtyError lists the migrations marked dirty in the metadata table.
+// errors.Is(err, ErrDirty) returns true for a DirtyError.
+type DirtyError struct {
+	Migrations []string
+}
+
+// Error lists the dirty migrations.
+func (e *DirtyError) Error() string {
+	return ErrDirty.Error() + ": " + strings.Join(e.Migrations, ", ")
+}
+
+// Is matches ErrDirty.
+func (e *DirtyError) Is(target error) bool {
+	return target == ErrDirty
+}
+
+// Dirty returns the migrations marked dirty in the metadata table, i.e. non-transactional
+// migrations that failed partway or are currently being applied.
+func Dirty(ctx context.Context, span Span, metadataTable string) ([]string, error) {
+	rows, err := span.QueryMigration(ctx, "select migration from "+metadataTable+" where dirty")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var migration string
+	var results []string
+
+	for rows.Next() {
+		if err := rows.Scan(&migration); err != nil {
+			return nil, err
+		}
+
+		results = append(results, migration)
+	}
+
+	return results, rows.Err()
+}
+
+// CheckDirty returns a DirtyError if any migrations are marked dirty in the metadata
+// table.
+func CheckDirty(ctx context.Context, span Span, metadataTable string) error {
+	dirty, err := Dirty(ctx, span, metadataTable)
+	if err != nil {
+		return err
+	}
+
+	if len(dirty) > 0 {
+		return &DirtyError{Migrations: dirty}
+	}
+
+	return nil
+}
+
+// ClearDirty clears the dirty marker on the migration once the database has been
+// repaired manually.  The migration is then considered applied.  To run the migration
+// again instead, delete its record from the metadata table.
+func (options Options) ClearDirty(ctx context.Context, span Span, migration string) error {
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return err
+	}
+
+	return markDirty(ctx, span, metadataTable, migration, false)
+}
+
+// Returns true if the migration may wait for the advisory lock held by another process
+// applying a non-transactional migration, i.e. the Span implements AdvisoryLocker and
+// the lock isn't already held.
+func (m Migration) canWait() bool {
+	if m.advisory || m.exclusive {
+		return false
+	}
+
+	_, ok := m.span.(AdvisoryLocker)
+	return ok
+}
+
+// Calls fn holding the advisory lock for the metadata table, so no other process is
+// applying a non-transactional migration while fn runs.  If the lock can't be held, see
+// canWait, calls fn without it.
+func (m Migration) exclusively(ctx context.Context, fn func(m Migration) error) error {
+	if !m.canWait() {
+		return fn(m)
+	}
+
+	unlock, err := m.span.(AdvisoryLocker).AdvisoryLock(ctx, noTxLock(m.metadataTable), m.lockWait)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock(ctx)
+	}()
+
+	m.exclusive = true
+	return fn(m)
+}
+
+// Checks for dirty migrations before applying any.  If a migration is dirty and the Span
+// implements AdvisoryLocker, waits for the advisory lock in case another process is still
+// applying the migration, then checks again.
+func (options Options) checkDirty(ctx context.Context, span Span, metadataTable string) error {
+	err := CheckDirty(ctx, span, metadataTable)
+
+	var dirty *DirtyError
+	if !errors.As(err, &dirty) || options.Locking == LockAdvisory {
+		return err
+	}
+
+	locker, ok := span.(AdvisoryLocker)
+	if !ok {
+		return err
+	}
+
+	unlock, err := locker.AdvisoryLock(ctx, noTxLock(metadataTable), options.LockWait)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock(ctx)
+	}()
+
+	return CheckDirty(ctx, span, metadataTable)
+}
+
+// Names the advisory lock held while a non-transactional migration runs.  It's distinct
+// from the metadata table's lock, which MySQL implements with the same kind of lock, so a
+// process holding it may still lock the metadata table.
+func noTxLock(metadataTable string) string {
+	return metadataTable + "#notx"
+}
+
+// Applies a section with the `notx` modifier outside a transaction.  The caller's
+// transaction `tx` must hold the metadata lock.
+//
+// The migration is claimed in the metadata table and marked dirty, then the metadata
+// lock is released while the SQL runs.  If the Span implements AdvisoryLocker, the
+// advisory lock is held throughout (see ReadAndApply), so any other process applying
+// migrations waits for the SQL to complete rather than report the migration dirty.
+// Otherwise the other process stops with a DirtyError, rather than applying migrations
+// out of order.  Once the SQL completes, the dirty marker is cleared.  If the SQL fails,
+// the migration remains dirty so an operator knows to repair the database.
+//
+// The SQL is always run statement by statement, as a multi-statement command may be
+// wrapped in an implicit transaction by the database.
+func (m Migration) applyNoTx(ctx context.Context, tx Span, path string) error {
+	if m.span.InTx() {
+		return fmt.Errorf("migration %s (%s): %w", path, m.direction, ErrNoTxInTransaction)
+	}
+
+	if len(m.searchPath) > 0 {
+		return fmt.Errorf("migration %s (%s): %w", path, m.direction, ErrNoTxSearchPath)
+	}
+
+	SQL, err := ReadSQL(m.reader, path, m.direction)
+	if err != nil {
+		return err
+	}
+
+	if m.direction == Up {
+		if err := Migrated(ctx, tx, m.reader, m.metadataTable, path, m.direction, m.rollbacks); err != nil {
+			return err
+		}
+	}
+
+	if err := markDirty(ctx, tx, m.metadataTable, path, true); err != nil {
+		return err
+	}
+
+	// Commit the claim on the migration, releasing the metadata lock
+	if err := tx.CommitMigration(ctx); err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	if err := execStatements(ctx, m.span, SQL); err != nil {
+		return fmt.Errorf("migration %s (%s) failed outside a transaction: %w: %w", path, m.direction, ErrDirty, err)
+	}
+
+	done, err := Begin(ctx, m.span)
+	if err != nil {
+		return err
+	}
+	defer TxClose(ctx, done)
+
+	if m.direction == Up {
+		if err := markDirty(ctx, done, m.metadataTable, path, false); err != nil {
+			return err
+		}
+
+		if err := RecordRun(ctx, done, m.metadataTable, path, time.Since(start), m.appliedBy, m.env); err != nil {
+			return err
+		}
+	} else if err := Migrated(ctx, done, m.reader, m.metadataTable, path, m.direction, m.rollbacks); err != nil {
+		return err
+	}
+
+	return done.CommitMigration(ctx)
+}
+
+// Sets or clears the dirty marker on the migration in the metadata table.
+func markDirty(ctx context.Context, span Span, metadataTable, path string, dirty bool) error {
+	return span.ExecMigration(ctx, "update "+metadataTable+" set dirty = $1 where migration = $2", dirty, Filename(path))
+}
@@ -1,9 +1,13 @@
 package migrations
 
 import (
+	"log/slog"
 	"os"
+	"os/user"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,6 +21,24 @@ const (
 	// EnvEmbeddedRollbacks when false disables embedding the rollback SQL in the
 	// database.
 	EnvEmbeddedRollbacks = "DB_EMBED"
+
+	// EnvChecksums sets how to handle applied migrations that were modified:
+	// "verify", "warn", or "ignore".
+	EnvChecksums = "DB_CHECKSUMS"
+
+	// EnvOutOfOrder sets how to handle migrations applied out of order: "allow",
+	// "warn", or "refuse".
+	EnvOutOfOrder = "DB_OUT_OF_ORDER"
+
+	// EnvLocking sets how to lock the migrations:  "table" or "advisory".
+	EnvLocking = "DB_LOCKING"
+
+	// EnvLockWait sets how long to wait for an advisory lock, e.g. "30s".
+	EnvLockWait = "DB_LOCK_WAIT"
+
+	// EnvEnvironment names the environment the migrations are applied in, e.g. "dev"
+	// or "production", for sections scoped to environments.
+	EnvEnvironment = "DB_ENV"
 )
 
 // Options manages the configuration of the migrations tool.
@@ -40,8 +62,92 @@ type Options struct {
 		Name   string
 	}
 
+	// Checksums indicates how to handle migration files modified after they were
+	// applied.  Defaults to ChecksumIgnore.
+	Checksums ChecksumMode
+
+	// OutOfOrder indicates how to handle migrations with a lower revision than those
+	// already applied.  Defaults to OutOfOrderAllow.
+	OutOfOrder OutOfOrderMode
+
+	// Timestamps has Create name new migrations using the current time as the
+	// revision, e.g. `20261016120000-add-users.sql`, rather than the next revision
+	// number.  This avoids developers on separate branches creating migrations with
+	// the same revision.
+	Timestamps bool
+
+	// Force has Baseline record migrations even if the metadata table already has
+	// migrations recorded.
+	Force bool
+
+	// Locking selects how to prevent multiple processes from applying migrations
+	// simultaneously.  Defaults to LockTable.
+	Locking LockMode
+
+	// LockWait is how long to wait for another process to release the advisory lock
+	// before failing with a LockTimeoutError.  Defaults to zero, waiting indefinitely.
+	// Only applies to LockAdvisory, or to LockTable with a Span that implements
+	// MetadataLockWaiter, such as MySQL's.
+	LockWait time.Duration
+
+	// AppliedBy is recorded in the metadata table with each migration applied, to
+	// identify who or what applied it.  Defaults to "user@hostname".
+	AppliedBy string
+
+	// Env names the environment the migrations are applied in, such as "dev" or
+	// "production".  Sections scoped to other environments, e.g.
+	// `--- !Up env=dev,test`, are skipped.  The environment is recorded in the metadata
+	// table with each migration applied.  See EnvReader.
+	Env string
+
+	// SplitStatements runs each migration statement by statement, rather than passing
+	// the entire section to the database in a single call.  Use this with database
+	// drivers that don't support multiple statements in a single call, or to report
+	// which statement failed.  See Split.
+	SplitStatements bool
+
+	// GoMigrations are applied in revision order alongside the SQL migration files.
+	GoMigrations []GoMigration
+
+	// Sources are named sets of migrations, each namespaced in the metadata table.
+	// If any are set, they're used instead of the Directory and GoMigrations.  See
+	// Source.
+	Sources []Source
+
+	// Logger logs each migration as it starts, finishes, or fails, along with any
+	// warnings.  If nil, nothing is logged, including warnings.
+	Logger *slog.Logger
+
+	// Hook is called as each migration starts, finishes, or fails.
+	Hook Hook
+
+	// SearchPath sets the PostgreSQL `search_path` in each migration's transaction, so
+	// unqualified names in the SQL refer to these schemas.  Non-transactional migrations
+	// can't be run with a search path.
+	SearchPath []string
+
+	// Tenants are the schemas ApplyTenants migrates, along with any schemas returned by
+	// TenantQuery.
+	Tenants []string
+
+	// TenantQuery selects the schemas for ApplyTenants to migrate, one per row.
+	TenantQuery string
+
+	// TenantConcurrency is how many tenant schemas ApplyTenants migrates at the same
+	// time.  Defaults to one at a time.
+	TenantConcurrency int
+
+	// LegacyTables are the metadata tables from github.com/sbowman/migrations that Apply
+	// looks for, in order, to adopt into an empty metadata table.  Defaults to
+	// DefaultLegacyTables.  See AdoptLegacy.
+	LegacyTables []string
+
 	// Reader defaults to the DiskReader for querying and ingesting migration files.
+	// Use an FSReader to read migrations embedded in the application binary.
 	Reader Reader
+
+	// The Source being migrated, whose migrations are namespaced in the metadata table
+	source string
 }
 
 // DefaultOptions returns the defaults for the migrations package.  They include:
@@ -49,7 +155,14 @@ type Options struct {
 // * Revision: Latest (`DB_REVISION`)
 // * Directory: ./sql (`DB_MIGRATIONS`)
 // * EmbeddedRollbacks: true (`DB_EMBED`)
+// * Checksums: ignore (`DB_CHECKSUMS`)
+// * OutOfOrder: allow (`DB_OUT_OF_ORDER`)
+// * Locking: table (`DB_LOCKING`)
+// * LockWait: wait indefinitely (`DB_LOCK_WAIT`)
+// * AppliedBy: the current user and host, e.g. `deploy@app-server-1`
+// * Env: blank, skipping sections scoped to environments (`DB_ENV`)
 // * MetadataTable: drawbridge.schema_migrations
+// * LegacyTables: migrations.applied, public.schema_migrations
 //
 // Note that the schema migrations table is not configurable via an environment variable.
 // It may be overridden by the application, but it's a bad idea to make this configurable.
@@ -58,6 +171,10 @@ func DefaultOptions() Options {
 	revision := Latest
 	directory := "./sql"
 	embed := true
+	checksums := ChecksumIgnore
+	outOfOrder := OutOfOrderAllow
+	locking := LockTable
+	var lockWait time.Duration
 	schemaTable := "drawbridge.schema_migrations"
 
 	if val := os.Getenv(EnvRevision); val != "" {
@@ -77,16 +194,62 @@ func DefaultOptions() Options {
 		}
 	}
 
+	if val := os.Getenv(EnvChecksums); val != "" {
+		switch mode := ChecksumMode(strings.ToLower(val)); mode {
+		case ChecksumVerify, ChecksumWarn, ChecksumIgnore:
+			checksums = mode
+		}
+	}
+
+	if val := os.Getenv(EnvOutOfOrder); val != "" {
+		switch mode := OutOfOrderMode(strings.ToLower(val)); mode {
+		case OutOfOrderAllow, OutOfOrderWarn, OutOfOrderRefuse:
+			outOfOrder = mode
+		}
+	}
+
+	if val := os.Getenv(EnvLocking); val != "" {
+		switch mode := LockMode(strings.ToLower(val)); mode {
+		case LockTable, LockAdvisory:
+			locking = mode
+		}
+	}
+
+	if val := os.Getenv(EnvLockWait); val != "" {
+		wait, err := time.ParseDuration(val)
+		if err == nil {
+			lockWait = wait
+		}
+	}
+
 	options := Options{
 		Revision:          revision,
 		Directory:         directory,
 		EmbeddedRollbacks: embed,
+		Checksums:         checksums,
+		OutOfOrder:        outOfOrder,
+		Locking:           locking,
+		LockWait:          lockWait,
+		AppliedBy:         appliedBy(),
+		Env:               os.Getenv(EnvEnvironment),
+		LegacyTables:      slices.Clone(DefaultLegacyTables),
 		Reader:            &DiskReader{},
 	}
 
 	return options.WithSchemaTable(schemaTable)
 }
 
+// WithAppliedBy overrides the default "user@hostname" recorded in the metadata table
+// with each migration.
+func WithAppliedBy(appliedBy string) Options {
+	return DefaultOptions().WithAppliedBy(appliedBy)
+}
+
+// WithEnv sets the environment the migrations are applied in, e.g. "dev" or "production".
+func WithEnv(env string) Options {
+	return DefaultOptions().WithEnv(env)
+}
+
 // WithRevision manually indicates the revision to migrate the database to.  By default,
 // the migrations to get the database to the revision indicated by the latest SQL
 // migration file is used.
@@ -106,6 +269,93 @@ func DisableEmbeddedRollbacks() Options {
 	return DefaultOptions().DisableEmbeddedRollbacks()
 }
 
+// WithChecksums sets how to handle migration files that were modified after they were
+// applied to the database.
+func WithChecksums(mode ChecksumMode) Options {
+	return DefaultOptions().WithChecksums(mode)
+}
+
+// WithOutOfOrder sets how to handle migrations with a lower revision than those already
+// applied to the database.
+func WithOutOfOrder(mode OutOfOrderMode) Options {
+	return DefaultOptions().WithOutOfOrder(mode)
+}
+
+// WithLocking selects how to prevent multiple processes from applying migrations
+// simultaneously.
+func WithLocking(mode LockMode) Options {
+	return DefaultOptions().WithLocking(mode)
+}
+
+// WithLockWait sets how long to wait for an advisory lock held by another process.
+func WithLockWait(wait time.Duration) Options {
+	return DefaultOptions().WithLockWait(wait)
+}
+
+// WithForce has Baseline record migrations even if the metadata table isn't empty.
+func WithForce(force bool) Options {
+	return DefaultOptions().WithForce(force)
+}
+
+// WithTimestamps has Create use the current time as the revision of new migrations.
+func WithTimestamps(timestamps bool) Options {
+	return DefaultOptions().WithTimestamps(timestamps)
+}
+
+// WithLogger logs each migration as it starts, finishes, or fails.
+func WithLogger(logger *slog.Logger) Options {
+	return DefaultOptions().WithLogger(logger)
+}
+
+// WithHook calls the hook as each migration starts, finishes, or fails.
+func WithHook(hook Hook) Options {
+	return DefaultOptions().WithHook(hook)
+}
+
+// WithSearchPath sets the PostgreSQL search path for the migrations.
+func WithSearchPath(schemas ...string) Options {
+	return DefaultOptions().WithSearchPath(schemas...)
+}
+
+// WithTenants adds schemas for ApplyTenants to migrate.
+func WithTenants(schemas ...string) Options {
+	return DefaultOptions().WithTenants(schemas...)
+}
+
+// WithTenantQuery sets the query that selects the schemas for ApplyTenants to migrate.
+func WithTenantQuery(query string) Options {
+	return DefaultOptions().WithTenantQuery(query)
+}
+
+// WithTenantConcurrency sets how many tenant schemas ApplyTenants migrates at the same
+// time.
+func WithTenantConcurrency(concurrency int) Options {
+	return DefaultOptions().WithTenantConcurrency(concurrency)
+}
+
+// WithGoMigrations registers migrations written in Go.
+func WithGoMigrations(migrations ...GoMigration) Options {
+	return DefaultOptions().WithGoMigrations(migrations...)
+}
+
+// WithSplitStatements runs each migration statement by statement.
+func WithSplitStatements(split bool) Options {
+	return DefaultOptions().WithSplitStatements(split)
+}
+
+// WithReader overrides the default DiskReader used to read the migration files.  For
+// example, use an FSReader to read migrations from an [embed.FS].
+func WithReader(reader Reader) Options {
+	return DefaultOptions().WithReader(reader)
+}
+
+// WithLegacyTables overrides the legacy metadata tables Apply looks for to adopt, e.g.
+// if github.com/sbowman/migrations was configured with a different table.  With no
+// tables, legacy metadata tables aren't adopted.
+func WithLegacyTables(schemaTables ...string) Options {
+	return DefaultOptions().WithLegacyTables(schemaTables...)
+}
+
 // WithSchemaTable overrides the default `drawbridge.schema_migrations` table to track the
 // database schema versions.  Note that this is not configurable via environment
 // variables, as it should never change once your app is deployed.  If you need to
@@ -136,6 +386,124 @@ func (options Options) DisableEmbeddedRollbacks() Options {
 	return options
 }
 
+// WithChecksums sets how to handle migration files that were modified after they were
+// applied to the database.
+func (options Options) WithChecksums(mode ChecksumMode) Options {
+	options.Checksums = mode
+	return options
+}
+
+// WithAppliedBy overrides the default "user@hostname" recorded in the metadata table
+// with each migration.
+func (options Options) WithAppliedBy(appliedBy string) Options {
+	options.AppliedBy = appliedBy
+	return options
+}
+
+// WithEnv sets the environment the migrations are applied in, e.g. "dev" or "production".
+// Sections scoped to other environments are skipped.
+func (options Options) WithEnv(env string) Options {
+	options.Env = env
+	return options
+}
+
+// WithOutOfOrder sets how to handle migrations with a lower revision than those already
+// applied to the database.
+func (options Options) WithOutOfOrder(mode OutOfOrderMode) Options {
+	options.OutOfOrder = mode
+	return options
+}
+
+// WithLocking selects how to prevent multiple processes from applying migrations
+// simultaneously.
+func (options Options) WithLocking(mode LockMode) Options {
+	options.Locking = mode
+	return options
+}
+
+// WithLockWait sets how long to wait for an advisory lock held by another process.
+func (options Options) WithLockWait(wait time.Duration) Options {
+	options.LockWait = wait
+	return options
+}
+
+// WithForce has Baseline record migrations even if the metadata table isn't empty.
+func (options Options) WithForce(force bool) Options {
+	options.Force = force
+	return options
+}
+
+// WithTimestamps has Create use the current time as the revision of new migrations.
+func (options Options) WithTimestamps(timestamps bool) Options {
+	options.Timestamps = timestamps
+	return options
+}
+
+// WithLogger logs each migration as it starts, finishes, or fails.
+func (options Options) WithLogger(logger *slog.Logger) Options {
+	options.Logger = logger
+	return options
+}
+
+// WithHook calls the hook as each migration starts, finishes, or fails.
+func (options Options) WithHook(hook Hook) Options {
+	options.Hook = hook
+	return options
+}
+
+// WithSearchPath sets the PostgreSQL search path for the migrations.
+func (options Options) WithSearchPath(schemas ...string) Options {
+	options.SearchPath = schemas
+	return options
+}
+
+// WithTenants adds schemas for ApplyTenants to migrate.
+func (options Options) WithTenants(schemas ...string) Options {
+	options.Tenants = slices.Concat(options.Tenants, schemas)
+	return options
+}
+
+// WithTenantQuery sets the query that selects the schemas for ApplyTenants to migrate.
+// The query should return a single column, the schema name.
+func (options Options) WithTenantQuery(query string) Options {
+	options.TenantQuery = query
+	return options
+}
+
+// WithTenantConcurrency sets how many tenant schemas ApplyTenants migrates at the same
+// time.
+func (options Options) WithTenantConcurrency(concurrency int) Options {
+	options.TenantConcurrency = concurrency
+	return options
+}
+
+// WithGoMigrations registers migrations written in Go.
+func (options Options) WithGoMigrations(migrations ...GoMigration) Options {
+	options.GoMigrations = slices.Concat(options.GoMigrations, migrations)
+	return options
+}
+
+// WithSplitStatements runs each migration statement by statement.
+func (options Options) WithSplitStatements(split bool) Options {
+	options.SplitStatements = split
+	return options
+}
+
+// WithReader overrides the default DiskReader used to read the migration files.  For
+// example, use an FSReader to read migrations from an [embed.FS].
+func (options Options) WithReader(reader Reader) Options {
+	options.Reader = reader
+	return options
+}
+
+// WithLegacyTables overrides the legacy metadata tables Apply looks for to adopt, e.g.
+// if github.com/sbowman/migrations was configured with a different table.  With no
+// tables, legacy metadata tables aren't adopted.
+func (options Options) WithLegacyTables(schemaTables ...string) Options {
+	options.LegacyTables = schemaTables
+	return options
+}
+
 // WithSchemaTable overrides the default `drawbridge.schema_migrations` table to track the
 // database schema versions.  Note that this is not configurable via environment
 // variables, as it should never change once your app is deployed.  If you need to
@@ -154,3 +522,23 @@ func (options Options) WithSchemaTable(schemaTable string) Options {
 
 	return options
 }
+
+// Returns the current user and hostname, e.g. "deploy@app-server-1".  If either is
+// unavailable, returns what's available.
+func appliedBy() string {
+	var name string
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return name
+	}
+
+	if name == "" {
+		return host
+	}
+
+	return name + "@" + host
+}
@@ -0,0 +1,110 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampFormat is the format of timestamp revisions, e.g. `20261016120000`, in UTC.
+const TimestampFormat = "20060102150405"
+
+// OutOfOrderMode controls how Apply handles migrations with a lower revision than
+// migrations already applied to the database, such as a migration created on a branch
+// that was merged after later migrations were deployed.
+type OutOfOrderMode string
+
+const (
+	// OutOfOrderAllow applies migrations out of order.  This is the default.
+	OutOfOrderAllow OutOfOrderMode = "allow"
+
+	// OutOfOrderWarn logs a warning, then applies migrations out of order.
+	OutOfOrderWarn OutOfOrderMode = "warn"
+
+	// OutOfOrderRefuse fails with an OutOfOrderError rather than apply migrations out
+	// of order.
+	OutOfOrderRefuse OutOfOrderMode = "refuse"
+)
+
+var (
+	// ErrOutOfOrder returned if migrations would be applied out of order and the
+	// options refuse to.  See OutOfOrderError for the list of migrations.
+	ErrOutOfOrder = errors.New("migrations would be applied out of order")
+)
+
+// OutOfOrderError lists the migrations that would be applied after migrations with a
+// higher revision.  errors.Is(err, ErrOutOfOrder) returns true for an OutOfOrderError.
+type OutOfOrderError struct {
+	Migrations []string
+}
+
+// Error lists the out of order migrations.
+func (e *OutOfOrderError) Error() string {
+	return ErrOutOfOrder.Error() + ": " + strings.Join(e.Migrations, ", ")
+}
+
+// Is matches ErrOutOfOrder.
+func (e *OutOfOrderError) Is(target error) bool {
+	return target == ErrOutOfOrder
+}
+
+// Returns the revision for a new migration:  the current time if using timestamps,
+// otherwise the next revision after the latest.
+func (options Options) nextRevision() string {
+	if options.Timestamps {
+		return time.Now().UTC().Format(TimestampFormat)
+	}
+
+	return strconv.Itoa(options.latestRevision() + 1)
+}
+
+// Returns the migrations that would be applied with a lower revision than the latest
+// migration applied to the database.
+func (options Options) pendingOutOfOrder(ctx context.Context, span Span, metadataTable string, migrations []string) ([]string, error) {
+	latest, err := latestMigration(ctx, span, metadataTable, options.source)
+	if err != nil {
+		return nil, err
+	}
+
+	latestRev, err := Revision(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []string
+
+	for _, migration := range migrations {
+		rev, err := Revision(migration)
+		if err != nil || rev >= latestRev {
+			continue
+		}
+
+		if ShouldRun(ctx, span, metadataTable, migration, Up, options.Revision) {
+			results = append(results, migration)
+		}
+	}
+
+	return results, nil
+}
+
+// Checks the migrations about to be applied for any out of order, according to the
+// options' OutOfOrder mode.
+func (options Options) checkOutOfOrder(ctx context.Context, span Span, metadataTable string, migrations []string) error {
+	if options.OutOfOrder != OutOfOrderWarn && options.OutOfOrder != OutOfOrderRefuse {
+		return nil
+	}
+
+	outOfOrder, err := options.pendingOutOfOrder(ctx, span, metadataTable, migrations)
+	if err != nil || len(outOfOrder) == 0 {
+		return err
+	}
+
+	if options.OutOfOrder == OutOfOrderRefuse {
+		return &OutOfOrderError{Migrations: outOfOrder}
+	}
+
+	options.logger().Warn("applying migrations out of order", "migrations", outOfOrder)
+	return nil
+}
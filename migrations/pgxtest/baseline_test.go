@@ -0,0 +1,76 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Can an existing database be baselined at a revision, then migrated from there?
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	// Schema created by hand...
+	_, err := db.Exec(ctx, "create table samples (name varchar(64) primary key, email varchar(1024))")
+	require.Nil(t, err)
+
+	options := migrations.WithDirectory("./testdata")
+
+	err = options.Baseline(ctx, db, 2)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-add-email-to-sample.sql"}, applied)
+
+	var rollback string
+	row := db.QueryRow(ctx, "select rollback from drawbridge.schema_migrations where migration = '2-add-email-to-sample.sql'")
+	assert.Nil(row.Scan(&rollback))
+	assert.Equal("alter table samples drop column email;", rollback)
+
+	// Can't baseline twice...
+	err = options.Baseline(ctx, db, 3)
+	assert.True(errors.Is(err, migrations.ErrMetadataNotEmpty))
+
+	// Migrate from the baseline
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row = db.QueryRow(ctx, "select count(*) from samples")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(2, count)
+}
+
+// Does forcing the baseline record the missing migrations?
+func TestBaselineForce(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("./testdata")
+
+	err := options.WithRevision(1).Apply(ctx, db)
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "alter table samples add column email varchar(1024)")
+	require.Nil(t, err)
+
+	err = options.WithForce(true).Baseline(ctx, db, 2)
+	require.Nil(t, err)
+
+	err = options.AtLatest(ctx, db)
+	assert.True(errors.Is(err, migrations.ErrMigrateRequired))
+
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("2-add-email-to-sample.sql", latest)
+}
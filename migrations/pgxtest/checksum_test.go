@@ -0,0 +1,77 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Is the checksum insensitive to whitespace, but sensitive to the SQL?
+func TestChecksum(t *testing.T) {
+	assert := assert.New(t)
+	reader := &StringReader{}
+
+	original, err := migrations.Checksum(reader, "--- !Up\ncreate table sample(id integer);\n--- !Down\ndrop table sample;\n")
+	assert.Nil(err)
+	assert.Len(original, 64)
+
+	spaced, err := migrations.Checksum(reader, "--- !Up\n\n  create table   sample(id integer);  \n\n--- !Down\n")
+	assert.Nil(err)
+	assert.Equal(original, spaced)
+
+	modified, err := migrations.Checksum(reader, "--- !Up\ncreate table sample(id bigint);\n--- !Down\ndrop table sample;\n")
+	assert.Nil(err)
+	assert.NotEqual(original, modified)
+}
+
+// Are modified migrations detected after they've been applied?
+func TestChecksumDrift(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	files := fstest.MapFS{
+		"sql/1-create-sample.sql": {Data: []byte("--- !Up\ncreate table samples (name varchar(64) primary key);\n\n--- !Down\ndrop table samples;\n")},
+	}
+
+	options := migrations.WithDirectory("sql").
+		WithReader(migrations.FromFS(files)).
+		WithChecksums(migrations.ChecksumVerify)
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	// Reformatting is fine...
+	files["sql/1-create-sample.sql"] = &fstest.MapFile{Data: []byte("--- !Up\ncreate table samples (name varchar(64) primary key);\n\n\n--- !Down\ndrop table samples;\n")}
+	assert.Nil(options.AtLatest(ctx, db))
+
+	// ...but changing the SQL is not
+	files["sql/1-create-sample.sql"] = &fstest.MapFile{Data: []byte("--- !Up\ncreate table samples (name varchar(128) primary key);\n\n--- !Down\ndrop table samples;\n")}
+
+	err = options.AtLatest(ctx, db)
+	assert.ErrorIs(err, migrations.ErrChecksumMismatch)
+
+	var mismatch *migrations.ChecksumError
+	if assert.True(errors.As(err, &mismatch)) {
+		assert.Equal([]string{"1-create-sample.sql"}, mismatch.Migrations)
+	}
+
+	err = options.Apply(ctx, db)
+	assert.ErrorIs(err, migrations.ErrChecksumMismatch)
+
+	err = options.WithChecksums(migrations.ChecksumWarn).Apply(ctx, db)
+	assert.Nil(err)
+
+	err = options.WithChecksums(migrations.ChecksumIgnore).AtLatest(ctx, db)
+	assert.Nil(err)
+
+	// Checksums aren't checked by default
+	err = migrations.WithDirectory("sql").WithReader(migrations.FromFS(files)).AtLatest(ctx, db)
+	assert.Nil(err)
+}
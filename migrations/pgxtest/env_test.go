@@ -0,0 +1,144 @@
+package pgxtest
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var envFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Up env=dev,test
+insert into samples (name) values ('demo');
+
+--- !Up env=production
+insert into samples (name) values ('production');
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-seed-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up env=dev
+insert into samples (name) values ('seed');
+
+--- !Down env=dev
+delete from samples where name = 'seed';
+`)},
+}
+
+// Are the sections for other environments skipped?
+func TestEnvReader(t *testing.T) {
+	assert := assert.New(t)
+
+	dev := &migrations.EnvReader{Reader: migrations.FromFS(envFS), Env: "dev"}
+
+	SQL, err := migrations.ReadSQL(dev, "sql/1-create-sample.sql", migrations.Up)
+	assert.Nil(err)
+	assert.Contains(SQL, "create table samples")
+	assert.Contains(SQL, "'demo'")
+	assert.NotContains(SQL, "'production'")
+	assert.Contains(SQL, "-- skipped, only for env=production")
+
+	production := &migrations.EnvReader{Reader: migrations.FromFS(envFS), Env: "Production"}
+
+	SQL, err = migrations.ReadSQL(production, "sql/1-create-sample.sql", migrations.Up)
+	assert.Nil(err)
+	assert.NotContains(SQL, "'demo'")
+	assert.Contains(SQL, "'production'")
+
+	// Without an environment, all the scoped sections are skipped
+	none := &migrations.EnvReader{Reader: migrations.FromFS(envFS)}
+
+	SQL, err = migrations.ReadSQL(none, "sql/2-seed-sample.sql", migrations.Up)
+	assert.Nil(err)
+	assert.Empty(migrations.Split(SQL))
+
+	section, err := migrations.ReadSection(migrations.FromFS(envFS), "sql/2-seed-sample.sql", migrations.Up, "")
+	assert.Nil(err)
+	assert.Equal([]string{"dev"}, section.Env)
+	assert.True(section.InEnv("DEV"))
+	assert.False(section.InEnv("test"))
+
+	// Modifiers only apply in the section's environments
+	scoped := fstest.MapFS{
+		"sql/1-index-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Up env=dev notx lock_timeout=5s
+create index concurrently samples_name_idx on samples (name);
+
+--- !Down
+drop table samples;
+`)},
+	}
+
+	section, err = migrations.ReadSection(migrations.FromFS(scoped), "sql/1-index-sample.sql", migrations.Up, "production")
+	assert.Nil(err)
+	assert.False(section.NoTx)
+	assert.Zero(section.LockTimeout)
+	assert.Equal([]string{"dev"}, section.Env)
+
+	section, err = migrations.ReadSection(migrations.FromFS(scoped), "sql/1-index-sample.sql", migrations.Up, "dev")
+	assert.Nil(err)
+	assert.True(section.NoTx)
+	assert.Equal(5*time.Second, section.LockTimeout)
+
+	// The checksum doesn't depend on the environment
+	checksum, err := migrations.Checksum(migrations.FromFS(envFS), "sql/1-create-sample.sql")
+	assert.Nil(err)
+
+	for _, reader := range []migrations.Reader{dev, production, none} {
+		envChecksum, err := migrations.Checksum(reader, "sql/1-create-sample.sql")
+		assert.Nil(err)
+		assert.Equal(checksum, envChecksum)
+	}
+}
+
+// Is the environment recorded, and are migrations skipped for the environment still
+// recorded as applied?
+func TestEnv(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(envFS)).
+		WithDirectory("sql").
+		WithEnv("production")
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	var names []string
+	rows, err := db.Query(ctx, "select name from samples order by name")
+	require.Nil(t, err)
+
+	for rows.Next() {
+		var name string
+		assert.Nil(rows.Scan(&name))
+		names = append(names, name)
+	}
+
+	assert.Nil(rows.Close())
+	assert.Equal([]string{"production"}, names)
+
+	report, err := options.Status(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, report, 2)
+	assert.Equal(migrations.StateApplied, report[1].State)
+	assert.Equal("production", report[1].Env)
+
+	// Checked from another environment, e.g. a health check, the migrations aren't modified
+	err = options.WithEnv("").VerifyChecksums(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+
+	// Rolls back cleanly, though the seed data was never added
+	err = options.WithRevision(0).Apply(ctx, db)
+	require.Nil(t, err)
+}
@@ -0,0 +1,102 @@
+package pgxtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Is the hook called as each migration starts and finishes?
+func TestHook(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	var events []migrations.Event
+	hook := func(_ context.Context, event migrations.Event) {
+		events = append(events, event)
+	}
+
+	options := migrations.WithDirectory("./testdata").WithHook(hook)
+
+	err := options.WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, events, 4)
+
+	assert.Equal(migrations.EventStart, events[0].Type)
+	assert.Equal("1-create-sample.sql", events[0].Migration)
+	assert.Equal(migrations.Up, events[0].Direction)
+	assert.Equal(migrations.EventFinish, events[1].Type)
+	assert.Equal("1-create-sample.sql", events[1].Migration)
+	assert.Equal(migrations.EventStart, events[2].Type)
+	assert.Equal("2-add-email-to-sample.sql", events[2].Migration)
+	assert.Equal(migrations.EventFinish, events[3].Type)
+
+	// Embedded rollbacks are reported too
+	events = nil
+
+	downgraded := migrations.WithReader(migrations.FromFS(fstest.MapFS{})).
+		WithDirectory("sql").
+		WithHook(hook)
+
+	err = downgraded.Apply(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, events, 4)
+
+	assert.Equal(migrations.EventStart, events[0].Type)
+	assert.Equal("2-add-email-to-sample.sql", events[0].Migration)
+	assert.Equal(migrations.Down, events[0].Direction)
+	assert.True(events[0].Embedded)
+	assert.Equal(migrations.EventFinish, events[3].Type)
+	assert.Equal("1-create-sample.sql", events[3].Migration)
+}
+
+// Are migration failures logged with the stable attribute names?
+func TestLogger(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	brokenFS := fstest.MapFS{
+		"sql/1-broken.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create tabel samples (name varchar(64));
+
+--- !Down
+`)},
+	}
+
+	err := migrations.WithReader(migrations.FromFS(brokenFS)).
+		WithDirectory("sql").
+		WithLogger(logger).
+		Apply(ctx, db)
+	require.NotNil(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var started, failed map[string]any
+	require.Nil(t, json.Unmarshal(lines[0], &started))
+	require.Nil(t, json.Unmarshal(lines[1], &failed))
+
+	assert.Equal("INFO", started["level"])
+	assert.Equal("start", started[migrations.AttrEvent])
+	assert.Equal("1-broken.sql", started[migrations.AttrMigration])
+	assert.Equal("up", started[migrations.AttrDirection])
+
+	assert.Equal("ERROR", failed["level"])
+	assert.Equal("failure", failed[migrations.AttrEvent])
+	assert.Contains(failed, migrations.AttrDuration)
+	assert.Contains(failed[migrations.AttrError], "tabel")
+}
@@ -5,20 +5,26 @@ go 1.23.0
 toolchain go1.24.0
 
 require (
-	github.com/jackc/pgx/v5 v5.7.4
-	github.com/sbowman/drawbridge v0.9.4
+	github.com/jackc/pgx/v5 v5.7.5
+	github.com/sbowman/drawbridge v0.9.7
 	github.com/sbowman/drawbridge/postgres v0.9.9
+	github.com/stretchr/testify v1.10.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.9.0
-	golang.org/x/crypto v0.36.0 // indirect
-	golang.org/x/sync v0.12.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
+	golang.org/x/crypto v0.38.0 // indirect
+	golang.org/x/sync v0.14.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace (
+	github.com/sbowman/drawbridge => ../..
+	github.com/sbowman/drawbridge/postgres => ../../postgres
+)
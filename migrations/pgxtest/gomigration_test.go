@@ -0,0 +1,136 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var goFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/3-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(1024);
+
+--- !Down
+alter table samples drop column email;
+`)},
+}
+
+// Backfills the samples table in Go.
+var backfill = migrations.GoMigration{
+	Revision: 2,
+	Name:     "backfill-samples",
+	Up: func(ctx context.Context, tx migrations.Span) error {
+		for _, name := range []string{"alice", "bob"} {
+			if err := tx.ExecMigration(ctx, "insert into samples (name) values ($1)", name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	Down: func(ctx context.Context, tx migrations.Span) error {
+		return tx.ExecMigration(ctx, "delete from samples")
+	},
+}
+
+// Are Go migrations applied and rolled back in revision order with the SQL migrations?
+func TestGoMigration(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(goFS)).
+		WithDirectory("sql").
+		WithGoMigrations(backfill)
+
+	plan, err := options.Plan(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, plan, 3)
+	assert.Equal("2-backfill-samples.go", plan[1].Migration)
+	assert.True(plan[1].Go)
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-backfill-samples.go", "3-add-email.sql"}, applied)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from samples")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(2, count)
+
+	// Applying again with all the embedded rollback logic changes nothing
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	err = options.Rollback(ctx, db, 2)
+	require.Nil(t, err)
+
+	row = db.QueryRow(ctx, "select count(*) from samples")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(0, count)
+
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("1-create-sample.sql", latest)
+}
+
+// Can the embedded rollbacks handle Go migrations that are no longer registered?
+func TestGoMigrationEmbeddedRollback(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(goFS)).
+		WithDirectory("sql").
+		WithGoMigrations(backfill)
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	// Deploy a previous version of the application without the Go migration
+	downgraded := migrations.WithReader(migrations.FromFS(fstest.MapFS{
+		"sql/1-create-sample.sql": goFS["sql/1-create-sample.sql"],
+	})).WithDirectory("sql")
+
+	err = downgraded.Apply(ctx, db)
+	assert.True(errors.Is(err, migrations.ErrRollbackUnavailable))
+
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("2-backfill-samples.go", latest)
+
+	// Without a Down function, there's nothing to roll back
+	clean(t, ctx)
+
+	noDown := backfill
+	noDown.Down = nil
+
+	err = migrations.WithReader(migrations.FromFS(goFS)).
+		WithDirectory("sql").
+		WithGoMigrations(noDown).
+		Apply(ctx, db)
+	require.Nil(t, err)
+
+	err = downgraded.Apply(ctx, db)
+	require.Nil(t, err)
+
+	latest, err = migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("1-create-sample.sql", latest)
+}
@@ -0,0 +1,193 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var golangMigrateFS = fstest.MapFS{
+	"sql/0001_create_samples.up.sql": &fstest.MapFile{Data: []byte(`create table samples (name varchar(64) not null);
+`)},
+	"sql/0001_create_samples.down.sql": &fstest.MapFile{Data: []byte(`drop table samples;
+`)},
+	"sql/0002_add_email.up.sql": &fstest.MapFile{Data: []byte(`alter table samples add column email varchar(1024);
+`)},
+	"sql/README.md": &fstest.MapFile{Data: []byte(`# Migrations`)},
+}
+
+var gooseFS = fstest.MapFS{
+	"sql/00001_create_samples.sql": &fstest.MapFile{Data: []byte(`-- +goose Up
+create table samples (name varchar(64) not null);
+
+-- +goose StatementBegin
+create function sample_name() returns trigger as $$
+begin
+    new.name = lower(new.name);
+    return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+drop function sample_name();
+drop table samples;
+`)},
+	"sql/00002_index_samples.sql": &fstest.MapFile{Data: []byte(`-- +goose NO TRANSACTION
+-- +goose Up
+create index concurrently samples_name_idx on samples (name);
+`)},
+	"sql/00003_add_email.sql": &fstest.MapFile{Data: []byte(`-- +goose Up
+alter table samples add column email varchar(1024);
+
+-- +goose Down
+alter table samples drop column email;
+`)},
+	"sql/00004_seed.go": &fstest.MapFile{Data: []byte(`package migrations`)},
+}
+
+// Are golang-migrate's up and down files read as a single migration?
+func TestGolangMigrateReader(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := migrations.FromGolangMigrate(migrations.FromFS(golangMigrateFS))
+
+	available, err := migrations.Available(reader, "sql", migrations.Up)
+	require.Nil(t, err)
+	assert.Equal([]string{"0001-create_samples.sql", "0002-add_email.sql"}, available)
+
+	SQL, err := migrations.ReadSQL(reader, "sql/0001-create_samples.sql", migrations.Up)
+	assert.Nil(err)
+	assert.Contains(SQL, "create table samples")
+
+	SQL, err = migrations.ReadSQL(reader, "sql/0001-create_samples.sql", migrations.Down)
+	assert.Nil(err)
+	assert.Contains(SQL, "drop table samples")
+
+	// Without a down file, the down section is empty
+	SQL, err = migrations.ReadSQL(reader, "sql/0002-add_email.sql", migrations.Down)
+	assert.Nil(err)
+	assert.Empty(migrations.Split(SQL))
+}
+
+// Are goose's annotations translated into sections?
+func TestGooseReader(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := migrations.FromGoose(migrations.FromFS(gooseFS))
+
+	available, err := migrations.Available(reader, "sql", migrations.Up)
+	require.Nil(t, err)
+	assert.Equal([]string{"00001-create_samples.sql", "00002-index_samples.sql", "00003-add_email.sql"}, available)
+
+	SQL, err := migrations.ReadSQL(reader, "sql/00001-create_samples.sql", migrations.Up)
+	assert.Nil(err)
+	assert.Len(migrations.Split(SQL), 2)
+	assert.NotContains(SQL, "drop table")
+
+	SQL, err = migrations.ReadSQL(reader, "sql/00001-create_samples.sql", migrations.Down)
+	assert.Nil(err)
+	assert.Len(migrations.Split(SQL), 2)
+
+	section, err := migrations.ReadSection(reader, "sql/00002-index_samples.sql", migrations.Up, "")
+	assert.Nil(err)
+	assert.True(section.NoTx)
+
+	// Without a Down annotation, the down section is empty
+	SQL, err = migrations.ReadSQL(reader, "sql/00002-index_samples.sql", migrations.Down)
+	assert.Nil(err)
+	assert.Empty(migrations.Split(SQL))
+
+	assert.Nil(migrations.WithReader(reader).WithDirectory("sql").Validate())
+}
+
+// Are the migrations applied by golang-migrate recorded, without running them again?
+func TestImportGolangMigrate(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	_, err := db.Exec(ctx, "create table schema_migrations (version bigint not null primary key, dirty boolean not null)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) not null)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into schema_migrations (version, dirty) values (1, true)")
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromGolangMigrate(migrations.FromFS(golangMigrateFS))).
+		WithDirectory("sql")
+
+	err = options.ImportGolangMigrate(ctx, db, migrations.GolangMigrateTable)
+	assert.True(errors.Is(err, migrations.ErrDirtyImport))
+
+	_, err = db.Exec(ctx, "update schema_migrations set dirty = false")
+	require.Nil(t, err)
+
+	err = options.ImportGolangMigrate(ctx, db, migrations.GolangMigrateTable)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal([]string{"0001-create_samples.sql"}, applied)
+
+	// Continues with the next golang-migrate migration
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from information_schema.columns where table_name = 'samples' and column_name = 'email'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+
+	err = options.ImportGolangMigrate(ctx, db, migrations.GolangMigrateTable)
+	assert.True(errors.Is(err, migrations.ErrMetadataNotEmpty))
+}
+
+// Are the migrations applied by goose recorded, including those applied out of order?
+func TestImportGoose(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	_, err := db.Exec(ctx, `create table goose_db_version (
+		id serial primary key,
+		version_id bigint not null,
+		is_applied boolean not null,
+		tstamp timestamp default now())`)
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) not null, email varchar(1024))")
+	require.Nil(t, err)
+
+	// Version 2 was rolled back
+	_, err = db.Exec(ctx, `insert into goose_db_version (version_id, is_applied) values
+		(0, true), (1, true), (2, true), (3, true), (2, false)`)
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromGoose(migrations.FromFS(gooseFS))).
+		WithDirectory("sql")
+
+	err = options.ImportGoose(ctx, db, migrations.GooseTable)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"00001-create_samples.sql", "00003-add_email.sql"}, applied)
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from pg_indexes where indexname = 'samples_name_idx'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+}
@@ -0,0 +1,98 @@
+package pgxtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Are the migrations recorded by sbowman/migrations adopted, rather than applied again?
+func TestAdoptLegacy(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+	defer func() {
+		if _, err := db.Exec(ctx, "drop schema if exists migrations cascade"); err != nil {
+			t.Fatalf("Unable to drop the migrations schema: %s", err)
+		}
+	}()
+
+	// Migrated by sbowman/migrations v2...
+	_, err := db.Exec(ctx, "create schema migrations")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table migrations.applied (migration varchar(1024) not null primary key, rollback text)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, `insert into migrations.applied (migration, rollback) values
+		('1-create-sample.sql', 'drop table samples'),
+		('2-add-email-to-sample.sql', null)`)
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) primary key, email varchar(1024))")
+	require.Nil(t, err)
+
+	options := migrations.WithDirectory("./testdata")
+
+	report, err := options.AdoptLegacy(ctx, db)
+	require.Nil(t, err)
+	assert.Equal(migrations.LegacyReport{Table: "migrations.applied", Migrations: 2, Rollbacks: 1}, report)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-add-email-to-sample.sql"}, applied)
+
+	// Only adopted once
+	report, err = options.AdoptLegacy(ctx, db)
+	require.Nil(t, err)
+	assert.Empty(report.Table)
+
+	// Migrate from the adopted revision
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from samples")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(2, count)
+}
+
+// Does Apply adopt the legacy table automatically, unless disabled?
+func TestApplyAdoptsLegacy(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	// Migrated by sbowman/migrations v1...
+	_, err := db.Exec(ctx, "create table schema_migrations (migration varchar(1024) not null primary key)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into schema_migrations (migration) values ('1-create-sample.sql')")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) primary key)")
+	require.Nil(t, err)
+
+	err = migrations.WithDirectory("./testdata").WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-add-email-to-sample.sql"}, applied)
+
+	// Without legacy tables, the migrations would be applied again
+	err = migrations.WithDirectory("./testdata").WithRevision(0).Apply(ctx, db)
+	require.Nil(t, err)
+
+	err = migrations.WithDirectory("./testdata").WithLegacyTables().Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err = migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Len(applied, 3)
+}
@@ -0,0 +1,72 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Can migrations be applied holding an advisory lock?
+func TestAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("./testdata").WithLocking(migrations.LockAdvisory)
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	err = options.AtLatest(ctx, db)
+	assert.Nil(err)
+
+	// The lock was released...
+	unlock, err := pgdb.AdvisoryLock(ctx, "drawbridge.schema_migrations", time.Second)
+	require.Nil(t, err)
+	assert.Nil(unlock(ctx))
+}
+
+// Does waiting for an advisory lock time out, identifying the process holding the lock?
+func TestAdvisoryLockTimeout(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	_, err := db.CreateMetadata(ctx, "drawbridge", "schema_migrations")
+	require.Nil(t, err)
+
+	unlock, err := pgdb.AdvisoryLock(ctx, "drawbridge.schema_migrations", 0)
+	require.Nil(t, err)
+
+	var pid int
+	row := pgdb.QueryRow(ctx, "select pid from pg_locks where locktype = 'advisory' and granted")
+	require.Nil(t, row.Scan(&pid))
+
+	options := migrations.WithDirectory("./testdata").
+		WithLocking(migrations.LockAdvisory).
+		WithLockWait(500 * time.Millisecond)
+
+	err = options.Apply(ctx, db)
+	require.NotNil(t, err)
+	assert.True(errors.Is(err, migrations.ErrLockTimeout))
+
+	var lockErr *migrations.LockTimeoutError
+	require.True(t, errors.As(err, &lockErr))
+	assert.Equal(pid, lockErr.PID)
+	assert.Equal(500*time.Millisecond, lockErr.Wait)
+
+	// Health checks may still read the metadata table
+	assert.True(errors.Is(options.AtLatest(ctx, db), migrations.ErrMigrateRequired))
+
+	assert.Nil(unlock(ctx))
+
+	err = options.Apply(ctx, db)
+	assert.Nil(err)
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/postgres"
 	"github.com/sbowman/drawbridge/postgres/std"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,18 +25,36 @@ select exists
                   table_name = $2)`
 )
 
-var db *std.DB
+// TestDB is the test database connection string.
+const TestDB = "postgres://postgres@localhost/migrations_test?sslmode=disable"
+
+var (
+	// The database/sql connection used by most of the tests.
+	db *std.DB
+
+	// The pgx-native connection pool, to confirm migrations work with postgres.Span.
+	pgdb *postgres.DB
+)
 
 func TestMain(m *testing.M) {
 	var err error
 
-	db, err = std.Open("postgres://postgres@localhost/migrations_test?sslmode=disable")
+	db, err = std.Open(TestDB)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to connect to migrations_test database: %s\n", err)
+		os.Exit(1)
+	}
+
+	pgdb, err = postgres.Open(TestDB)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Unable to connect to migrations_test database: %s\n", err)
 		os.Exit(1)
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	pgdb.Shutdown()
+
+	os.Exit(code)
 }
 
 // TestMatch checks that we can match "up" and "down" sections in the files.
@@ -248,6 +267,32 @@ func TestTransactions(t *testing.T) {
 	}
 }
 
+// Can the pgx-native postgres.DB apply and roll back migrations?
+func TestPgxSpan(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("./testdata")
+
+	err := options.WithRevision(2).Apply(ctx, pgdb)
+	require.Nil(t, err)
+
+	_, err = pgdb.Exec(ctx, "insert into samples (name, email) values ('Bob', 'bob@home.com')")
+	assert.Nil(err)
+
+	latest, err := migrations.LatestMigration(ctx, pgdb, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("2-add-email-to-sample.sql", latest)
+
+	err = options.Rollback(ctx, pgdb, 1)
+	require.Nil(t, err)
+
+	_, err = pgdb.Exec(ctx, "insert into samples (name, email) values ('Alice', 'alice@home.com')")
+	assert.Error(err)
+}
+
 func TestCustomMetadataTable(t *testing.T) {
 	assert := assert.New(t)
 	ctx := context.Background()
@@ -311,6 +356,42 @@ func TestCustomMetadataTable(t *testing.T) {
 	assert.ErrorIs(err, sql.ErrNoRows)
 }
 
+// Is a metadata table created by an older version of the migrations package upgraded?
+func TestUpgradeMetadata(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	defer clean(t, ctx)
+
+	_, err := db.Exec(ctx, "create schema drawbridge")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table drawbridge.schema_migrations(migration varchar(1024) not null primary key, rollback text)")
+	require.Nil(t, err)
+
+	options := migrations.WithDirectory("./testdata").WithAppliedBy("tester")
+
+	err = options.WithRevision(1).Apply(ctx, db)
+	require.Nil(t, err)
+
+	var version int
+	row := db.QueryRow(ctx, "select version from drawbridge.schema_migrations_version")
+	assert.Nil(row.Scan(&version))
+	assert.Equal(std.MetadataVersion, version)
+
+	var checksum, appliedBy string
+	var duration int64
+	row = db.QueryRow(ctx, "select checksum, applied_by, duration_ms from drawbridge.schema_migrations where migration = '1-create-sample.sql'")
+	assert.Nil(row.Scan(&checksum, &appliedBy, &duration))
+	assert.Len(checksum, 64)
+	assert.Equal("tester", appliedBy)
+	assert.GreaterOrEqual(duration, int64(0))
+
+	// Upgrading again does nothing
+	_, err = db.CreateMetadata(ctx, "drawbridge", "schema_migrations")
+	assert.Nil(err)
+}
+
 // Clean out the database.
 func clean(t *testing.T, ctx context.Context) {
 	if err := tableExists(ctx, "drawbridge.schema_migrations"); err == nil {
@@ -324,6 +405,11 @@ func clean(t *testing.T, ctx context.Context) {
 		t.Fatalf("Unable to drop drawbridge.schema_migrations table: %s", err)
 	}
 
+	_, err = db.Exec(ctx, "drop table if exists drawbridge.schema_migrations_version")
+	if err != nil {
+		t.Fatalf("Unable to drop drawbridge.schema_migrations_version table: %s", err)
+	}
+
 	_, err = db.Exec(ctx, "drop schema if exists drawbridge")
 	if err != nil {
 		t.Fatalf("Unable to drop drawbridge schema: %s", err)
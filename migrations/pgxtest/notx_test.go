@@ -0,0 +1,156 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var notxFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-index-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up notx
+create index concurrently samples_name_idx on samples (name);
+
+--- !Down notx
+drop index concurrently samples_name_idx;
+`)},
+	"sql/3-broken-index.sql": &fstest.MapFile{Data: []byte(`--- !Up notx
+create index concurrently samples_missing_idx on samples (missing);
+
+--- !Down
+`)},
+}
+
+// Can a migration run outside a transaction, e.g. to create an index concurrently?
+func TestNoTx(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(notxFS)).WithDirectory("sql")
+
+	err := options.WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from pg_indexes where indexname = 'samples_name_idx'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+
+	dirty, err := migrations.Dirty(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Empty(dirty)
+
+	err = options.WithRevision(1).Apply(ctx, db)
+	require.Nil(t, err)
+
+	row = db.QueryRow(ctx, "select count(*) from pg_indexes where indexname = 'samples_name_idx'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(0, count)
+}
+
+// Is a failed non-transactional migration marked dirty, blocking further migrations until
+// cleared?
+func TestNoTxDirty(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(notxFS)).WithDirectory("sql")
+
+	err := options.Apply(ctx, db)
+	require.NotNil(t, err)
+	assert.True(errors.Is(err, migrations.ErrDirty))
+
+	err = options.Apply(ctx, db)
+	require.NotNil(t, err)
+
+	var dirtyErr *migrations.DirtyError
+	require.True(t, errors.As(err, &dirtyErr))
+	assert.Equal([]string{"3-broken-index.sql"}, dirtyErr.Migrations)
+
+	report, err := options.Status(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, report, 3)
+	assert.True(report[2].Dirty)
+
+	// Repaired manually...
+	err = options.ClearDirty(ctx, db, "3-broken-index.sql")
+	require.Nil(t, err)
+
+	err = options.Apply(ctx, db)
+	assert.Nil(err)
+}
+
+// Does another process wait for a non-transactional migration in progress, rather than
+// report it dirty?
+func TestNoTxInProgress(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	slowFS := fstest.MapFS{
+		"sql/1-create-sample.sql": notxFS["sql/1-create-sample.sql"],
+		"sql/2-index-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up notx
+select pg_sleep(1);
+create index concurrently samples_name_idx on samples (name);
+
+--- !Down notx
+drop index concurrently samples_name_idx;
+`)},
+	}
+
+	options := migrations.WithReader(migrations.FromFS(slowFS)).WithDirectory("sql")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- options.Apply(ctx, db)
+	}()
+
+	// Wait for the first process to claim the migration
+	require.Eventually(t, func() bool {
+		dirty, err := migrations.Dirty(ctx, db, "drawbridge.schema_migrations")
+		return err == nil && len(dirty) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err := options.Apply(ctx, db)
+	assert.Nil(err)
+	assert.Nil(<-done)
+
+	dirty, err := migrations.Dirty(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Empty(dirty)
+}
+
+// Are non-transactional migrations refused inside a transaction?
+func TestNoTxInTransaction(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	tx, err := db.BeginMigration(ctx)
+	require.Nil(t, err)
+	defer func() {
+		_ = tx.CloseMigration(ctx)
+	}()
+
+	options := migrations.WithReader(migrations.FromFS(notxFS)).WithDirectory("sql")
+
+	err = options.WithRevision(2).Apply(ctx, tx)
+	assert.True(errors.Is(err, migrations.ErrNoTxInTransaction))
+}
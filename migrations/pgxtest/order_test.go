@@ -0,0 +1,97 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var orderFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(1024);
+
+--- !Down
+alter table samples drop column email;
+`)},
+	"sql/3-add-phone.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column phone varchar(32);
+
+--- !Down
+alter table samples drop column phone;
+`)},
+}
+
+// Does Create name new migrations with a timestamp revision?
+func TestCreateTimestamp(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+
+	path, err := migrations.WithDirectory(dir).WithTimestamps(true).Create("add-users")
+	require.Nil(t, err)
+
+	filename := filepath.Base(path)
+	assert.Regexp(regexp.MustCompile(`^\d{14}-add-users\.sql$`), filename)
+
+	rev, err := migrations.Revision(filename)
+	assert.Nil(err)
+	assert.Greater(rev, 20000101000000)
+
+	path, err = migrations.WithDirectory(dir).Create("add-emails")
+	require.Nil(t, err)
+	assert.Equal(rev+1, mustRevision(t, path))
+}
+
+// Are out of order migrations refused, or applied with a warning, per the options?
+func TestOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	// Revision 2 was merged after revision 3 was deployed...
+	skipped := fstest.MapFS{
+		"sql/1-create-sample.sql": orderFS["sql/1-create-sample.sql"],
+		"sql/3-add-phone.sql":     orderFS["sql/3-add-phone.sql"],
+	}
+
+	err := migrations.WithReader(migrations.FromFS(skipped)).WithDirectory("sql").Apply(ctx, db)
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromFS(orderFS)).WithDirectory("sql")
+
+	err = options.WithOutOfOrder(migrations.OutOfOrderRefuse).Apply(ctx, db)
+	require.NotNil(t, err)
+
+	var outOfOrder *migrations.OutOfOrderError
+	require.True(t, errors.As(err, &outOfOrder))
+	assert.Equal([]string{"2-add-email.sql"}, outOfOrder.Migrations)
+
+	assert.False(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "2-add-email.sql"))
+
+	err = options.WithOutOfOrder(migrations.OutOfOrderWarn).Apply(ctx, db)
+	require.Nil(t, err)
+
+	assert.True(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "2-add-email.sql"))
+}
+
+// Returns the revision of the migration at the path.
+func mustRevision(t *testing.T, path string) int {
+	rev, err := migrations.Revision(filepath.Base(path))
+	require.Nil(t, err)
+
+	return rev
+}
@@ -0,0 +1,83 @@
+package pgxtest
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Does the plan list the migrations and SQL without changing the database?
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("./testdata")
+
+	err := options.WithRevision(1).Apply(ctx, db)
+	require.Nil(t, err)
+
+	plan, err := options.WithRevision(2).Plan(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, plan, 1)
+
+	assert.Equal("2-add-email-to-sample.sql", plan[0].Migration)
+	assert.Equal(migrations.Up, plan[0].Direction)
+	assert.Contains(plan[0].SQL, "alter table samples add column email")
+	assert.False(plan[0].Embedded)
+
+	// Nothing changed...
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("1-create-sample.sql", latest)
+
+	err = options.WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	plan, err = options.PlanRollback(ctx, db, 2)
+	require.Nil(t, err)
+	require.Len(t, plan, 2)
+
+	assert.Equal("2-add-email-to-sample.sql", plan[0].Migration)
+	assert.Equal(migrations.Down, plan[0].Direction)
+	assert.Equal("1-create-sample.sql", plan[1].Migration)
+	assert.Equal(migrations.Down, plan[1].Direction)
+
+	script := plan.Script()
+	assert.Contains(script, "-- 2-add-email-to-sample.sql (down)\nbegin;\nalter table samples drop column email;\ncommit;\n")
+	assert.Contains(script, "-- 1-create-sample.sql (down)\nbegin;\ndrop table samples;\ncommit;\n")
+}
+
+// Are embedded rollbacks included in the plan when the migration files are gone?
+func TestPlanEmbeddedRollbacks(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	err := migrations.WithDirectory("./testdata").WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	// Simulate deploying the previous release, which only has the first migration
+	files := fstest.MapFS{
+		"sql/1-create-sample.sql": {Data: []byte("--- !Up\ncreate table samples (\n    name varchar(64) primary key\n);\n\n--- !Down\ndrop table samples\n")},
+	}
+
+	options := migrations.WithDirectory("sql").WithReader(migrations.FromFS(files))
+
+	plan, err := options.Plan(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, plan, 1)
+
+	assert.Equal("2-add-email-to-sample.sql", plan[0].Migration)
+	assert.Equal(migrations.Down, plan[0].Direction)
+	assert.Equal("alter table samples drop column email;", plan[0].SQL)
+	assert.True(plan[0].Embedded)
+
+	assert.Contains(plan.Script(), "(down, embedded rollback)")
+}
@@ -0,0 +1,62 @@
+package pgxtest
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Embedded migrations for testing the FSReader.
+var sqlFS = fstest.MapFS{
+	"sql/1-create-sample.sql":       {Data: []byte("--- !Up\ncreate table samples (name varchar(64) primary key);\n\n--- !Down\ndrop table samples;\n")},
+	"sql/2-add-email-to-sample.sql": {Data: []byte("--- !Up\nalter table samples add column email varchar(1024);\n\n--- !Down\nalter table samples drop column email;\n")},
+	"sql/README.md":                 {Data: []byte("not a migration")},
+	"sql/nested/3-ignored.sql":      {Data: []byte("--- !Up\nselect 1;\n")},
+}
+
+// Can the FSReader list and read migrations from an fs.FS?
+func TestFSReader(t *testing.T) {
+	assert := assert.New(t)
+	reader := migrations.FromFS(sqlFS)
+
+	available, err := migrations.Available(reader, "./sql", migrations.Up)
+	assert.Nil(err)
+	assert.Equal([]string{"1-create-sample.sql", "2-add-email-to-sample.sql"}, available)
+
+	assert.Equal(2, migrations.LatestRevision(reader, "sql"))
+
+	doc, err := migrations.ReadSQL(reader, migrations.Join("./sql", "1-create-sample.sql"), migrations.Up)
+	assert.Nil(err)
+	assert.Contains(doc, "create table samples")
+	assert.NotContains(doc, "drop table samples")
+
+	_, err = migrations.ReadSQL(reader, "sql/9-missing.sql", migrations.Up)
+	assert.Error(err)
+
+	available, err = migrations.Available(reader, "missing", migrations.Up)
+	assert.Nil(err)
+	assert.Empty(available)
+}
+
+// Are embedded migrations applied to the database?
+func TestFSApply(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("sql").WithReader(migrations.FromFS(sqlFS))
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into samples (name, email) values ('Bob', 'bob@home.com')")
+	assert.Nil(err)
+
+	err = options.AtLatest(ctx, db)
+	assert.Nil(err)
+}
@@ -0,0 +1,35 @@
+package pgxtest
+
+import (
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// Are the `$1` placeholders rewritten as `?` placeholders, with the args in order?
+func TestRebind(t *testing.T) {
+	assert := assert.New(t)
+
+	query, args := migrations.Rebind("update schema_migrations set rollback = $1, irreversible = $2 where migration = $3",
+		[]any{"drop table samples", false, "1-create-sample.sql"})
+	assert.Equal("update schema_migrations set rollback = ?, irreversible = ? where migration = ?", query)
+	assert.Equal([]any{"drop table samples", false, "1-create-sample.sql"}, args)
+
+	// Reused and out of order placeholders
+	query, args = migrations.Rebind("delete from schema_migrations where migration = $2 or squashed_by = $2 or migration = $1",
+		[]any{"a", "b"})
+	assert.Equal("delete from schema_migrations where migration = ? or squashed_by = ? or migration = ?", query)
+	assert.Equal([]any{"b", "b", "a"}, args)
+
+	// Strings, identifiers, and comments are left alone
+	query, args = migrations.Rebind("select '$1', 'it''s $1', `$1` -- $1\nfrom t /* $1 */ where a = $1", []any{1})
+	assert.Equal("select '$1', 'it''s $1', `$1` -- $1\nfrom t /* $1 */ where a = ?", query)
+	assert.Equal([]any{1}, args)
+
+	// Without args, the SQL isn't touched
+	SQL := "create function f() returns int return $1;"
+	query, args = migrations.Rebind(SQL, nil)
+	assert.Equal(SQL, query)
+	assert.Empty(args)
+}
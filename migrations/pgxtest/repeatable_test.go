@@ -0,0 +1,95 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var repeatableFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null, email varchar(1024));
+
+--- !Down
+drop table samples;
+`)},
+	"sql/R-sample-names.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create or replace view sample_names as select name from samples;
+`)},
+	"sql/R-sample-emails.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create or replace view sample_emails as select email from samples;
+`)},
+}
+
+// Are repeatable migrations run after the versioned migrations, and only when changed?
+func TestRepeatable(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	var started []string
+	hook := func(_ context.Context, event migrations.Event) {
+		if event.Type == migrations.EventStart {
+			started = append(started, event.Migration)
+		}
+	}
+
+	options := migrations.WithReader(migrations.FromFS(repeatableFS)).
+		WithDirectory("sql").
+		WithHook(hook)
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+	assert.Equal([]string{"1-create-sample.sql", "R-sample-emails.sql", "R-sample-names.sql"}, started)
+
+	assert.Nil(tableExists(ctx, "sample_names"))
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal([]string{"1-create-sample.sql"}, applied)
+
+	assert.Nil(options.AtLatest(ctx, db))
+
+	// Unchanged repeatable migrations are skipped
+	started = nil
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+	assert.Empty(started)
+
+	// Changed repeatable migrations are run again
+	changed := fstest.MapFS{
+		"sql/1-create-sample.sql": repeatableFS["sql/1-create-sample.sql"],
+		"sql/R-sample-names.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create or replace view sample_names as select name, email from samples;
+`)},
+		"sql/R-sample-emails.sql": repeatableFS["sql/R-sample-emails.sql"],
+	}
+
+	options = migrations.WithReader(migrations.FromFS(changed)).
+		WithDirectory("sql").
+		WithHook(hook)
+
+	assert.True(errors.Is(options.AtLatest(ctx, db), migrations.ErrMigrateRequired))
+
+	plan, err := options.Plan(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, plan, 1)
+	assert.Equal("R-sample-names.sql", plan[0].Migration)
+	assert.True(plan[0].Repeatable)
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+	assert.Equal([]string{"R-sample-names.sql"}, started)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from information_schema.columns where table_name = 'sample_names'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(2, count)
+}
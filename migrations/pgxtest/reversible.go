@@ -0,0 +1,148 @@
+package pgxtest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+)
+
+// The schemas PostgreSQL manages itself
+const systemSchemas = `('pg_catalog', 'information_schema', 'pg_toast')`
+
+// Each query returns the schema and name of the table the object belongs to, so objects
+// on the metadata tables may be skipped, and a description of the object.
+var fingerprintQueries = []string{
+	// Columns
+	`select table_schema::text, table_name::text, 'column ' || table_schema || '.' || table_name || '.' || column_name || ' ' ||
+	        data_type || coalesce('(' || character_maximum_length || ')', '') ||
+	        case when is_nullable = 'NO' then ' not null' else '' end ||
+	        coalesce(' default ' || column_default, '')
+	 from information_schema.columns
+	 where table_schema not in ` + systemSchemas,
+
+	// Constraints, such as primary keys, foreign keys, and checks
+	`select n.nspname, cl.relname, 'constraint ' || n.nspname || '.' || cl.relname || '.' || c.conname || ' ' || pg_get_constraintdef(c.oid)
+	 from pg_constraint c
+	 join pg_class cl on cl.oid = c.conrelid
+	 join pg_namespace n on n.oid = cl.relnamespace
+	 where n.nspname not in ` + systemSchemas,
+
+	// Indexes
+	`select schemaname, tablename, 'index ' || indexdef
+	 from pg_indexes
+	 where schemaname not in ` + systemSchemas,
+
+	// Views
+	`select schemaname, viewname, 'view ' || schemaname || '.' || viewname || ': ' || definition
+	 from pg_views
+	 where schemaname not in ` + systemSchemas,
+
+	// Triggers
+	`select trigger_schema::text, event_object_table::text, 'trigger ' || trigger_schema || '.' || trigger_name || ' ' ||
+	        action_timing || ' ' || event_manipulation || ' on ' || event_object_table || ' ' || action_statement
+	 from information_schema.triggers
+	 where trigger_schema not in ` + systemSchemas,
+
+	// Functions and procedures
+	`select n.nspname, p.proname, 'function ' || n.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')'
+	 from pg_proc p
+	 join pg_namespace n on n.oid = p.pronamespace
+	 where n.nspname not in ` + systemSchemas,
+
+	// Sequences
+	`select sequence_schema::text, sequence_name::text, 'sequence ' || sequence_schema || '.' || sequence_name
+	 from information_schema.sequences
+	 where sequence_schema not in ` + systemSchemas,
+
+	// Enumerated types
+	`select n.nspname, t.typname, 'enum ' || n.nspname || '.' || t.typname || ' (' || string_agg(e.enumlabel, ', ' order by e.enumsortorder) || ')'
+	 from pg_type t
+	 join pg_enum e on e.enumtypid = t.oid
+	 join pg_namespace n on n.oid = t.typnamespace
+	 group by n.nspname, t.typname`,
+}
+
+// Fingerprint describes the columns, constraints, indexes, views, triggers, functions,
+// sequences, and enumerated types in the PostgreSQL database, one per line, excluding the
+// metadata table.  Use it with [migrations.Options.CheckReversible], or see
+// AssertReversible.
+func Fingerprint(ctx context.Context, span migrations.Span, metadataTable string) (string, error) {
+	skip := map[string]bool{
+		qualified(metadataTable):              true,
+		qualified(metadataTable + "_version"): true,
+	}
+
+	var lines []string
+
+	for _, query := range fingerprintQueries {
+		found, err := describe(ctx, span, query, skip)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, found...)
+	}
+
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Runs the fingerprint query, skipping the objects belonging to the tables in skip.
+func describe(ctx context.Context, span migrations.Span, query string, skip map[string]bool) ([]string, error) {
+	rows, err := span.QueryMigration(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var lines []string
+
+	for rows.Next() {
+		var schema, table, line string
+		if err := rows.Scan(&schema, &table, &line); err != nil {
+			return nil, err
+		}
+
+		if skip[schema+"."+table] {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// Adds the public schema to the table name if it doesn't have a schema.
+func qualified(table string) string {
+	if !strings.Contains(table, ".") {
+		return "public." + table
+	}
+
+	return table
+}
+
+// AssertReversible applies each pending migration, rolls it back, and fails the test if
+// the PostgreSQL schema doesn't match what it was before the migration was applied.  The
+// failure names the migration and shows the difference in the schema.  Returns true if
+// every migration is reversible.  Run it against an empty test database:
+//
+//	func TestMigrationsReversible(t *testing.T) {
+//		pgxtest.AssertReversible(ctx, t, db, migrations.WithDirectory("./sql"))
+//	}
+func AssertReversible(ctx context.Context, t testing.TB, span migrations.Span, options migrations.Options) bool {
+	t.Helper()
+
+	if err := options.CheckReversible(ctx, span, Fingerprint); err != nil {
+		t.Error(err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Do the sample migrations roll back cleanly?
+func TestAssertReversible(t *testing.T) {
+	ctx := context.Background()
+
+	defer clean(t, ctx)
+
+	AssertReversible(ctx, t, db, migrations.WithDirectory("./testdata"))
+
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(t, err)
+	assert.Equal(t, "3-sample-data.sql", latest)
+}
+
+// Is a migration whose "down" SQL leaves changes behind reported?
+func TestCheckReversibleFails(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	broken := fstest.MapFS{
+		"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) primary key);
+
+--- !Down
+drop table samples;
+`)},
+		"sql/2-add-phone.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column phone varchar(32);
+create index idx_sample_name on samples (name);
+
+--- !Down
+alter table samples drop column phone;
+`)},
+	}
+
+	options := migrations.WithReader(migrations.FromFS(broken)).WithDirectory("sql")
+
+	err := options.CheckReversible(ctx, db, Fingerprint)
+	require.NotNil(t, err)
+	assert.True(errors.Is(err, migrations.ErrNotReversible))
+
+	var reversible *migrations.ReversibleError
+	require.True(t, errors.As(err, &reversible))
+	assert.Equal("2-add-phone.sql", reversible.Migration)
+	assert.Contains(reversible.Diff, "+ index CREATE INDEX idx_sample_name ON public.samples USING btree (name)")
+	assert.NotContains(reversible.Diff, "schema_migrations")
+}
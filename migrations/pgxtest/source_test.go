@@ -0,0 +1,177 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var billingFS = fstest.MapFS{
+	"sql/1-create-invoices.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table invoices (sample varchar(64) not null references samples (name));
+
+--- !Down
+drop table invoices;
+`)},
+}
+
+// Are the sources applied in order, each namespaced in the metadata table?
+func TestSources(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	// Billing is added first, but ordered after core
+	options := migrations.WithSource(migrations.Source{
+		Name:      "billing",
+		Directory: "sql",
+		Reader:    migrations.FromFS(billingFS),
+		After:     []string{"core"},
+	}).WithSource(migrations.Source{
+		Name:      "core",
+		Directory: "./testdata",
+	})
+
+	plan, err := options.Plan(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, plan, 4)
+	assert.Equal("core", plan[0].Source)
+	assert.Equal("core:1-create-sample.sql", plan[0].Migration)
+	assert.Equal("billing", plan[3].Source)
+	assert.Equal("billing:1-create-invoices.sql", plan[3].Migration)
+	assert.Contains(plan.Script(), "-- billing:1-create-invoices.sql (up)")
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	assert.Nil(options.AtLatest(ctx, db))
+
+	// Both sources share the metadata table
+	assert.True(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "core:3-sample-data.sql"))
+	assert.True(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "billing:1-create-invoices.sql"))
+	assert.Nil(tableExists(ctx, "drawbridge.schema_migrations"))
+	assert.NotNil(tableExists(ctx, "drawbridge.schema_migrations_billing"))
+
+	report, err := options.Status(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, report, 4)
+	assert.Equal("billing", report[3].Source)
+	assert.Equal(migrations.StateApplied, report[3].State)
+
+	// Each source has its own revisions, so the sources can't be moved to one
+	err = options.WithRevision(0).Apply(ctx, db)
+	assert.True(errors.Is(err, migrations.ErrSourceRevision))
+
+	err = options.Rollback(ctx, db, 1)
+	assert.True(errors.Is(err, migrations.ErrSourceRevision))
+
+	_, err = options.PlanRollback(ctx, db, 1)
+	assert.True(errors.Is(err, migrations.ErrSourceRevision))
+
+	// Roll back just the billing source
+	billing, err := options.Source("billing")
+	require.Nil(t, err)
+
+	plan, err = billing.PlanRollback(ctx, db, 1)
+	require.Nil(t, err)
+	require.Len(t, plan, 1)
+	assert.Equal("billing:1-create-invoices.sql", plan[0].Migration)
+
+	err = billing.Rollback(ctx, db, 1)
+	require.Nil(t, err)
+
+	assert.NotNil(tableExists(ctx, "invoices"))
+	assert.Nil(tableExists(ctx, "samples"))
+	assert.True(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "core:3-sample-data.sql"))
+	assert.False(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "billing:1-create-invoices.sql"))
+
+	// The core source moves to a revision on its own
+	core, err := options.Source("core")
+	require.Nil(t, err)
+
+	err = core.WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	assert.False(migrations.IsMigrated(ctx, db, "drawbridge.schema_migrations", "core:3-sample-data.sql"))
+	assert.True(errors.Is(options.AtLatest(ctx, db), migrations.ErrMigrateRequired))
+
+	_, err = options.Source("missing")
+	assert.True(errors.Is(err, migrations.ErrUnknownSource))
+}
+
+// Are problems with the sources' ordering reported?
+func TestSourcesOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	cycle := migrations.WithSource(migrations.Source{Name: "a", Directory: "./testdata", After: []string{"b"}}).
+		WithSource(migrations.Source{Name: "b", Directory: "./testdata", After: []string{"a"}})
+
+	err := cycle.Validate()
+	assert.True(errors.Is(err, migrations.ErrSourceCycle))
+
+	unknown := migrations.WithSource(migrations.Source{Name: "a", Directory: "./testdata", After: []string{"missing"}})
+
+	err = unknown.Validate()
+	assert.True(errors.Is(err, migrations.ErrUnknownSource))
+
+	duplicate := migrations.WithSource(migrations.Source{Name: "a", Directory: "./testdata"}).
+		WithSource(migrations.Source{Name: "a", Directory: "./testdata"})
+
+	err = duplicate.Validate()
+	assert.True(errors.Is(err, migrations.ErrDuplicateSource))
+
+	valid := migrations.WithSource(migrations.Source{Name: "a", Directory: "./testdata"}).
+		WithSource(migrations.Source{Name: "b", Directory: "./testdata", After: []string{"a"}})
+
+	assert.Nil(valid.Validate())
+
+	invalid := migrations.WithSource(migrations.Source{Name: "a:b", Directory: "./testdata"})
+
+	err = invalid.Validate()
+	assert.True(errors.Is(err, migrations.ErrInvalidSource))
+}
+
+// Are a source's migrations namespaced, while still read from the source's files?
+func TestSourceNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	source, filename := migrations.SplitNamespace("billing:1-create-invoices.sql")
+	assert.Equal("billing", source)
+	assert.Equal("1-create-invoices.sql", filename)
+
+	source, filename = migrations.SplitNamespace("1-create-sample.sql")
+	assert.Empty(source)
+	assert.Equal("1-create-sample.sql", filename)
+
+	rev, err := migrations.Revision("sql/billing:1-create-invoices.sql")
+	assert.Nil(err)
+	assert.Equal(1, rev)
+	assert.True(migrations.IsRepeatable("billing:R-views.sql"))
+
+	billing, err := migrations.WithSource(migrations.Source{
+		Name:      "billing",
+		Directory: "sql",
+		Reader:    migrations.FromFS(billingFS),
+		GoMigrations: []migrations.GoMigration{
+			{Revision: 2, Name: "backfill-invoices"},
+		},
+	}).Source("billing")
+	require.Nil(t, err)
+
+	available, err := migrations.Available(billing.Reader, "sql", migrations.Up)
+	assert.Nil(err)
+	assert.Equal([]string{"billing:1-create-invoices.sql"}, available)
+	assert.Equal("billing:2-backfill-invoices.go", billing.GoMigrations[0].Filename())
+
+	SQL, err := migrations.ReadSQL(billing.Reader, "sql/billing:1-create-invoices.sql", migrations.Up)
+	assert.Nil(err)
+	assert.Contains(SQL, "create table invoices")
+
+	assert.Nil(billing.Validate())
+}
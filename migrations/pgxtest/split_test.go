@@ -0,0 +1,190 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Are statements split on semicolons, ignoring those in comments and strings?
+func TestSplit(t *testing.T) {
+	assert := assert.New(t)
+
+	statements := migrations.Split(`
+-- create the table; add data
+create table samples (name varchar(64) not null);
+
+/* a block; /* nested; */ comment */
+insert into samples values ('semi;colon'), (E'it\'s; escaped'), ('it''s; doubled');
+
+select "odd;column" from samples;
+`)
+
+	require.Len(t, statements, 3)
+	assert.Equal("-- create the table; add data\ncreate table samples (name varchar(64) not null)", statements[0])
+	assert.Equal(`/* a block; /* nested; */ comment */
+insert into samples values ('semi;colon'), (E'it\'s; escaped'), ('it''s; doubled')`, statements[1])
+	assert.Equal(`select "odd;column" from samples`, statements[2])
+}
+
+// Are MySQL's backslash escapes honored in string literals?
+func TestSplitBackslashEscapes(t *testing.T) {
+	assert := assert.New(t)
+
+	SQL := `insert into samples values ('it\'s; fine'), ("say \"hi\"; twice"), ('back\\');
+select ` + "`odd;column`" + ` from samples;
+`
+
+	statements := migrations.SplitBackslashEscapes(SQL)
+	require.Len(t, statements, 2)
+	assert.Equal(`insert into samples values ('it\'s; fine'), ("say \"hi\"; twice"), ('back\\')`, statements[0])
+	assert.Equal("select `odd;column` from samples", statements[1])
+
+	// In PostgreSQL, the backslash is a plain character, so the string ends early
+	assert.Len(migrations.Split(`insert into samples values ('back\'); select 1;`), 2)
+}
+
+// Are dollar-quoted function bodies kept intact?
+func TestSplitDollarQuotes(t *testing.T) {
+	assert := assert.New(t)
+
+	statements := migrations.Split(`
+create function add_one(i integer) returns integer as $$
+begin
+    return i + 1;
+end;
+$$ language plpgsql;
+
+create function greet() returns text as $body$
+    select 'hello; $$ world';
+$body$ language sql;
+
+prepare find(integer) as select * from samples where id = $1;
+`)
+
+	require.Len(t, statements, 3)
+	assert.Contains(statements[0], "return i + 1;\nend;\n$$ language plpgsql")
+	assert.Contains(statements[1], "select 'hello; $$ world';\n$body$ language sql")
+	assert.Equal("prepare find(integer) as select * from samples where id = $1", statements[2])
+}
+
+// Are BEGIN ... END blocks in triggers kept intact?
+func TestSplitTrigger(t *testing.T) {
+	assert := assert.New(t)
+
+	statements := migrations.Split(`
+create trigger samples_updated after update on samples
+begin
+    update samples set size = case when new.size > 10 then 10 else new.size end;
+    insert into audit values (new.id);
+end;
+
+begin;
+select 1;
+commit;
+
+-- trailing comment
+`)
+
+	require.Len(t, statements, 4)
+	assert.Contains(statements[0], "insert into audit values (new.id);\nend")
+	assert.Equal([]string{"begin", "select 1", "commit"}, statements[1:])
+}
+
+// Do END IF, END LOOP, and the like close their control flow, rather than the block?
+func TestSplitControlFlow(t *testing.T) {
+	assert := assert.New(t)
+
+	statements := migrations.Split(`create procedure p() begin if x then select 1; end if; select 2; end; select 3;`)
+	assert.Equal([]string{"create procedure p() begin if x then select 1; end if; select 2; end", "select 3"}, statements)
+
+	statements = migrations.Split(`
+create procedure fill(n int)
+begin
+    declare i int default 0;
+    fill_loop: loop
+        set i = i + 1;
+        while i < 3 do
+            set i = i + 1;
+        end while;
+        repeat
+            set i = i + 1;
+        until i > 5 end repeat;
+        case i
+            when 1 then insert into samples values (1);
+            else begin
+                insert into samples values (case when i > 2 then 2 else i end);
+            end;
+        end case;
+        if i >= n then
+            leave fill_loop;
+        elseif i > 10 then
+            leave fill_loop;
+        end if;
+    end loop fill_loop;
+end;
+
+create trigger samples_inserted after insert on samples
+for each row
+begin
+    if new.id > 0 then
+        insert into audit values (new.id);
+    end if;
+end;
+
+select 1;
+`)
+
+	require.Len(t, statements, 3)
+	assert.True(strings.HasSuffix(statements[0], "end loop fill_loop;\nend"))
+	assert.True(strings.HasSuffix(statements[1], "end if;\nend"))
+	assert.Equal("select 1", statements[2])
+}
+
+// Does a failed statement report its position when running statement by statement?
+func TestSplitApply(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	splitFS := fstest.MapFS{
+		"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+insert into samples values ('one; two');
+
+--- !Down
+drop table samples;
+`)},
+		"sql/2-broken.sql": &fstest.MapFile{Data: []byte(`--- !Up
+insert into samples values ('three');
+insert into samples values (null);
+
+--- !Down
+`)},
+	}
+
+	options := migrations.WithReader(migrations.FromFS(splitFS)).
+		WithDirectory("sql").
+		WithSplitStatements(true)
+
+	err := options.Apply(ctx, db)
+	require.NotNil(t, err)
+
+	var stmtErr *migrations.StatementError
+	require.True(t, errors.As(err, &stmtErr))
+	assert.Equal(2, stmtErr.Index)
+	assert.Equal("insert into samples values (null)", stmtErr.Statement)
+
+	// First migration applied, second rolled back
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from samples")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+}
@@ -0,0 +1,147 @@
+package pgxtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Copies the testdata migrations to a temporary directory, so they may be squashed.
+func copyTestdata(t *testing.T) string {
+	dir := t.TempDir()
+
+	files, err := os.ReadDir("./testdata")
+	require.Nil(t, err)
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join("./testdata", file.Name()))
+		require.Nil(t, err)
+		require.Nil(t, os.WriteFile(filepath.Join(dir, file.Name()), data, 0644))
+	}
+
+	return dir
+}
+
+// Does squashing replace the original migration files?
+func TestSquash(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := copyTestdata(t)
+
+	path, err := migrations.WithDirectory(dir).Squash(2)
+	require.Nil(t, err)
+	assert.Equal(filepath.Join(dir, "2-squashed.sql"), path)
+
+	available, err := migrations.Available(&migrations.DiskReader{}, dir, migrations.Up)
+	assert.Nil(err)
+	assert.Equal([]string{"2-squashed.sql", "3-sample-data.sql"}, available)
+
+	squashes, err := migrations.ReadSquashes(&migrations.DiskReader{}, path)
+	assert.Nil(err)
+	assert.Equal([]string{"1-create-sample.sql", "2-add-email-to-sample.sql"}, squashes)
+
+	up, err := migrations.ReadSQL(&migrations.DiskReader{}, path, migrations.Up)
+	assert.Nil(err)
+	assert.Regexp(`(?s)create table samples.*alter table samples add column email`, up)
+
+	down, err := migrations.ReadSQL(&migrations.DiskReader{}, path, migrations.Down)
+	assert.Nil(err)
+	assert.Regexp(`(?s)alter table samples drop column email;.*drop table samples;`, down)
+
+	_, err = migrations.WithDirectory(dir).Squash(1)
+	assert.ErrorIs(err, migrations.ErrNothingToSquash)
+}
+
+// Can an irreversible migration with an empty "down" section be squashed?
+func TestSquashStop(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := copyTestdata(t)
+
+	err := os.WriteFile(filepath.Join(dir, "4-drop-email.sql"), []byte(`--- !Up
+alter table samples drop column email;
+
+--- !Down /stop
+`), 0644)
+	require.Nil(t, err)
+
+	path, err := migrations.WithDirectory(dir).Squash(4)
+	require.Nil(t, err)
+
+	section, err := migrations.ReadSection(&migrations.DiskReader{}, path, migrations.Down, "")
+	assert.Nil(err)
+	assert.True(section.Stop)
+
+	down, err := migrations.ReadSQL(&migrations.DiskReader{}, path, migrations.Down)
+	assert.Nil(err)
+	assert.Contains(down, "drop table samples;")
+}
+
+// Does a database that applied the original migrations skip the squashed migration?
+func TestSquashApplied(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	dir := copyTestdata(t)
+
+	err := migrations.WithDirectory(dir).WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	_, err = migrations.WithDirectory(dir).Squash(2)
+	require.Nil(t, err)
+
+	options := migrations.WithDirectory(dir)
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"2-squashed.sql", "3-sample-data.sql"}, applied)
+
+	var squashedBy string
+	row := db.QueryRow(ctx, "select squashed_by from drawbridge.schema_migrations where migration = '1-create-sample.sql'")
+	assert.Nil(row.Scan(&squashedBy))
+	assert.Equal("2-squashed.sql", squashedBy)
+
+	// Rolling back the squashed migration cleans up the originals
+	err = options.WithRevision(0).Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row = db.QueryRow(ctx, "select count(*) from drawbridge.schema_migrations")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(0, count)
+}
+
+// Does a new database run the squashed migration?
+func TestSquashNew(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	dir := copyTestdata(t)
+
+	_, err := migrations.WithDirectory(dir).Squash(2)
+	require.Nil(t, err)
+
+	err = migrations.WithDirectory(dir).Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from samples where email is not null")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+
+	applied, err := migrations.Applied(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"2-squashed.sql", "3-sample-data.sql"}, applied)
+}
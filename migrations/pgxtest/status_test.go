@@ -0,0 +1,59 @@
+package pgxtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Does the status report classify applied, pending, missing and out-of-order migrations?
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithDirectory("./testdata")
+
+	err := options.WithRevision(2).Apply(ctx, db)
+	require.Nil(t, err)
+
+	// Pretend the first migration was never applied, and a migration from a later
+	// release was applied...
+	_, err = db.Exec(ctx, "delete from drawbridge.schema_migrations where migration = '1-create-sample.sql'")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into drawbridge.schema_migrations (migration, rollback) values ('9-from-the-future.sql', 'select 1')")
+	require.Nil(t, err)
+
+	report, err := options.Status(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, report, 4)
+
+	expected := []struct {
+		migration string
+		revision  int
+		state     migrations.State
+		embedded  bool
+	}{
+		{"1-create-sample.sql", 1, migrations.StateOutOfOrder, false},
+		{"2-add-email-to-sample.sql", 2, migrations.StateApplied, true},
+		{"3-sample-data.sql", 3, migrations.StateOutOfOrder, false},
+		{"9-from-the-future.sql", 9, migrations.StateMissing, true},
+	}
+
+	for i, status := range report {
+		assert.Equal(expected[i].migration, status.Migration)
+		assert.Equal(expected[i].revision, status.Revision)
+		assert.Equal(expected[i].state, status.State)
+		assert.Equal(expected[i].embedded, status.EmbeddedRollback)
+	}
+
+	// Applied migrations record when and by whom
+	assert.False(report[1].AppliedAt.IsZero())
+	assert.NotEmpty(report[1].AppliedBy)
+	assert.Empty(report[3].AppliedBy)
+}
@@ -0,0 +1,89 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var stopFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null, legacy integer);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-drop-legacy.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples drop column legacy;
+
+--- !Down /stop
+`)},
+	"sql/3-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(1024);
+
+--- !Down
+alter table samples drop column email;
+`)},
+}
+
+// Does rolling back past a /stop migration halt with a StoppedError?
+func TestStop(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(stopFS)).WithDirectory("sql")
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	_, err = options.PlanRollback(ctx, db, 2)
+	assert.True(errors.Is(err, migrations.ErrStopped))
+
+	err = options.Rollback(ctx, db, 2)
+	require.NotNil(t, err)
+
+	var stopped *migrations.StoppedError
+	require.True(t, errors.As(err, &stopped))
+	assert.Equal("2-drop-legacy.sql", stopped.Migration)
+
+	// Revision 3 was rolled back, but not revision 2
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("2-drop-legacy.sql", latest)
+}
+
+// Does an embedded rollback past a /stop migration halt with a StoppedError?
+func TestStopEmbedded(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(stopFS)).WithDirectory("sql")
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	// Deploy a previous version of the application without any migration files
+	downgraded := migrations.WithReader(migrations.FromFS(fstest.MapFS{
+		"sql/1-create-sample.sql": stopFS["sql/1-create-sample.sql"],
+	})).WithDirectory("sql")
+
+	err = downgraded.Apply(ctx, db)
+	require.NotNil(t, err)
+
+	var stopped *migrations.StoppedError
+	require.True(t, errors.As(err, &stopped))
+	assert.Equal("2-drop-legacy.sql", stopped.Migration)
+
+	latest, err := migrations.LatestMigration(ctx, db, "drawbridge.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("2-drop-legacy.sql", latest)
+}
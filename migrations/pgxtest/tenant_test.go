@@ -0,0 +1,155 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Is each tenant schema migrated with its own metadata table?
+func TestApplyTenants(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer cleanTenants(t, ctx, "tenant_a", "tenant_b")
+
+	options := migrations.WithDirectory("./testdata").
+		WithTenants("tenant_a", "tenant_b").
+		WithTenantConcurrency(2)
+
+	report, err := options.ApplyTenants(ctx, db)
+	require.Nil(t, err)
+	require.Len(t, report, 2)
+	assert.Empty(report.Failed())
+
+	for _, schema := range []string{"tenant_a", "tenant_b"} {
+		var count int
+		row := db.QueryRow(ctx, "select count(*) from "+schema+".samples")
+		assert.Nil(row.Scan(&count))
+		assert.Equal(2, count)
+
+		latest, err := migrations.LatestMigration(ctx, db, schema+".schema_migrations")
+		assert.Nil(err)
+		assert.Equal("3-sample-data.sql", latest)
+	}
+
+	// Nothing was created in the public schema
+	assert.NotNil(tableExists(ctx, "samples"))
+}
+
+// Does a failure in one tenant leave the others migrated?
+func TestApplyTenantsFailure(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer cleanTenants(t, ctx, "tenant_a", "tenant_b", "tenant_c")
+
+	// The first migration fails, since the table already exists
+	_, err := db.Exec(ctx, "create schema tenant_b")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table tenant_b.samples (id integer)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create schema tenant_c")
+	require.Nil(t, err)
+
+	options := migrations.WithDirectory("./testdata").
+		WithTenants("tenant_a").
+		WithTenantQuery("select nspname from pg_namespace where nspname like 'tenant%' order by nspname")
+
+	report, err := options.ApplyTenants(ctx, db)
+	require.NotNil(t, err)
+	assert.Contains(err.Error(), "tenant tenant_b:")
+
+	require.Len(t, report, 3)
+	assert.Equal("tenant_a", report[0].Schema)
+	assert.Nil(report[0].Err)
+	assert.Equal("tenant_b", report[1].Schema)
+	assert.NotNil(report[1].Err)
+	assert.Equal("tenant_c", report[2].Schema)
+	assert.Nil(report[2].Err)
+
+	failed := report.Failed()
+	require.Len(t, failed, 1)
+	assert.Equal("tenant_b", failed[0].Schema)
+
+	latest, err := migrations.LatestMigration(ctx, db, "tenant_c.schema_migrations")
+	assert.Nil(err)
+	assert.Equal("3-sample-data.sql", latest)
+}
+
+// Are non-transactional migrations refused with a search path?
+func TestApplyTenantsNoTx(t *testing.T) {
+	ctx := context.Background()
+
+	defer cleanTenants(t, ctx, "tenant_a")
+
+	options := migrations.WithReader(migrations.FromFS(notxFS)).
+		WithDirectory("sql").
+		WithTenants("tenant_a")
+
+	report, err := options.ApplyTenants(ctx, db)
+	require.NotNil(t, err)
+	require.Len(t, report, 1)
+	assert.True(t, errors.Is(report[0].Err, migrations.ErrNoTxSearchPath))
+}
+
+// Drops the tenant schemas.
+func cleanTenants(t *testing.T, ctx context.Context, schemas ...string) {
+	for _, schema := range schemas {
+		if _, err := db.Exec(ctx, "drop schema if exists "+schema+" cascade"); err != nil {
+			t.Fatalf("Unable to drop schema %s: %s", schema, err)
+		}
+	}
+}
+
+// Is a panic migrating a tenant reported as the tenant's error, rather than crashing?
+func TestApplyTenantsPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	options := migrations.WithDirectory("./testdata").WithTenants("tenant_a", "tenant_b")
+
+	report, err := options.ApplyTenants(context.Background(), panicSpan{})
+	assert.True(errors.Is(err, migrations.ErrTenantPanic))
+	require.Len(t, report, 2)
+
+	for _, result := range report {
+		assert.True(errors.Is(result.Err, migrations.ErrTenantPanic))
+		assert.Contains(result.Err.Error(), "lost connection")
+	}
+}
+
+// A Span whose every call panics, as a backend helper might.
+type panicSpan struct{}
+
+func (panicSpan) CreateMetadata(context.Context, string, string) (string, error) {
+	panic("lost connection")
+}
+
+func (panicSpan) LockMetadata(context.Context, string) error { panic("lost connection") }
+func (panicSpan) UnlockMetadata(context.Context, string)     { panic("lost connection") }
+func (panicSpan) InTx() bool                                 { return false }
+
+func (panicSpan) BeginMigration(context.Context) (migrations.Span, error) {
+	panic("lost connection")
+}
+
+func (panicSpan) CommitMigration(context.Context) error { panic("lost connection") }
+func (panicSpan) CloseMigration(context.Context) error  { panic("lost connection") }
+
+func (panicSpan) ExecMigration(context.Context, string, ...any) error {
+	panic("lost connection")
+}
+
+func (panicSpan) QueryMigration(context.Context, string, ...any) (migrations.Rows, error) {
+	panic("lost connection")
+}
+
+func (panicSpan) QueryRowMigration(context.Context, string, ...any) migrations.Row {
+	panic("lost connection")
+}
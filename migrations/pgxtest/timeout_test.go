@@ -0,0 +1,123 @@
+package pgxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var timeoutFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up lock_timeout=100ms statement_timeout=1m retries=3
+alter table samples add column email varchar(1024);
+
+--- !Down lock_timeout=100ms
+alter table samples drop column email;
+`)},
+}
+
+// Are the timeouts and retries read from the section directive?
+func TestSectionTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := migrations.FromFS(timeoutFS)
+
+	section, err := migrations.ReadSection(reader, "sql/2-add-email.sql", migrations.Up, "")
+	assert.Nil(err)
+	assert.Equal(100*time.Millisecond, section.LockTimeout)
+	assert.Equal(time.Minute, section.StatementTimeout)
+	assert.Equal(3, section.Retries)
+
+	section, err = migrations.ReadSection(reader, "sql/2-add-email.sql", migrations.Down, "")
+	assert.Nil(err)
+	assert.Equal(100*time.Millisecond, section.LockTimeout)
+	assert.Zero(section.StatementTimeout)
+	assert.Zero(section.Retries)
+
+	// Invalid values are reported
+	invalid := fstest.MapFS{
+		"sql/1-invalid.sql": &fstest.MapFile{Data: []byte(`--- !Up lock_timeout=5 retries=many
+select 1;
+`)},
+	}
+
+	_, err = migrations.ReadSection(migrations.FromFS(invalid), "sql/1-invalid.sql", migrations.Up, "")
+	assert.True(errors.Is(err, migrations.ErrInvalidModifier))
+	assert.Contains(err.Error(), "1-invalid.sql: invalid section modifier lock_timeout=5")
+}
+
+// Does a migration waiting on a lock time out, and succeed when retried after the lock is
+// released?
+func TestLockTimeoutRetry(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(timeoutFS)).WithDirectory("sql")
+
+	err := options.WithRevision(1).Apply(ctx, db)
+	require.Nil(t, err)
+
+	plan, err := options.Plan(ctx, db)
+	require.Nil(t, err)
+	assert.Contains(plan.Script(), "set local lock_timeout = '100ms';")
+	assert.Contains(plan.Script(), "set local statement_timeout = '60000ms';")
+
+	// A long-running transaction holds a lock on the table...
+	holder, err := pgdb.Begin(ctx)
+	require.Nil(t, err)
+
+	_, err = holder.Exec(ctx, "lock table samples in access exclusive mode")
+	require.Nil(t, err)
+
+	var attempts int
+	options = options.WithHook(func(_ context.Context, event migrations.Event) {
+		if event.Type == migrations.EventStart {
+			attempts++
+		}
+	})
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = holder.Close(ctx)
+	}()
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+	assert.Greater(attempts, 1)
+
+	var count int
+	row := db.QueryRow(ctx, "select count(*) from information_schema.columns where table_name = 'samples' and column_name = 'email'")
+	assert.Nil(row.Scan(&count))
+	assert.Equal(1, count)
+
+	// Without retries, the rollback fails with the lock timeout
+	holder, err = pgdb.Begin(ctx)
+	require.Nil(t, err)
+	defer func() {
+		_ = holder.Close(ctx)
+	}()
+
+	_, err = holder.Exec(ctx, "lock table samples in access exclusive mode")
+	require.Nil(t, err)
+
+	err = options.WithRevision(1).Apply(ctx, db)
+	require.NotNil(t, err)
+
+	var pgerr *pgconn.PgError
+	require.ErrorAs(t, err, &pgerr)
+	assert.Equal("55P03", pgerr.Code) // i.e., lock not available
+}
@@ -0,0 +1,80 @@
+package pgxtest
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// Do the sample migrations validate?
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	err := migrations.WithDirectory("./testdata").Validate()
+	assert.Nil(err)
+
+	err = migrations.WithReader(migrations.FromFS(stopFS)).WithDirectory("sql").Validate()
+	assert.Nil(err)
+}
+
+// Are all the problems with the migrations reported?
+func TestValidateProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	invalidFS := fstest.MapFS{
+		"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) not null);
+
+--- !Down
+drop table samples;
+`)},
+		"sql/2-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(1024);
+
+--- !Down
+`)},
+		"sql/2-add-phone.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column phone varchar(32);
+
+--- !Down
+alter table samples drop column phone;
+`)},
+		"sql/5-no-up.sql": &fstest.MapFile{Data: []byte(`alter table samples add column age integer;
+
+--- !Down
+alter table samples drop column age;
+`)},
+		"sql/6-add-index.sql": &fstest.MapFile{Data: []byte(`--- !Up lock_timeout=5000
+create index samples_name_idx on samples (name);
+
+--- !Down
+drop index samples_name_idx;
+`)},
+		"sql/add-address.sql": &fstest.MapFile{Data: []byte(`--- !Up
+--- !Down
+`)},
+		"sql/README.md": &fstest.MapFile{Data: []byte(`Not a migration`)},
+	}
+
+	err := migrations.WithReader(migrations.FromFS(invalidFS)).WithDirectory("sql").Validate()
+	if !assert.NotNil(err) {
+		return
+	}
+
+	assert.True(errors.Is(err, migrations.ErrInvalidFilename))
+	assert.True(errors.Is(err, migrations.ErrDuplicateRevision))
+	assert.True(errors.Is(err, migrations.ErrMissingUp))
+	assert.True(errors.Is(err, migrations.ErrEmptyDown))
+	assert.True(errors.Is(err, migrations.ErrRevisionGap))
+	assert.True(errors.Is(err, migrations.ErrInvalidModifier))
+
+	assert.Contains(err.Error(), "add-address.sql")
+	assert.Contains(err.Error(), "2-add-email.sql, 2-add-phone.sql")
+	assert.Contains(err.Error(), "5-no-up.sql: no up section")
+	assert.Contains(err.Error(), "2-add-email.sql: empty down section")
+	assert.Contains(err.Error(), "no revision 3")
+	assert.Contains(err.Error(), "6-add-index.sql: invalid section modifier lock_timeout=5000")
+}
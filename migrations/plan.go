@@ -0,0 +1,336 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Step is a single migration in a Plan.
+type Step struct {
+	// Migration is the filename of the migration.
+	Migration string
+
+	// Direction indicates if the migration will be applied (Up) or rolled back (Down).
+	Direction Direction
+
+	// SQL is the exact SQL that will be run.  Blank for a Go migration.
+	SQL string
+
+	// Embedded is true if the SQL is a rollback embedded in the metadata table, rather
+	// than from the migration file.
+	Embedded bool
+
+	// NoTx is true if the section has the `notx` modifier and will be run outside a
+	// transaction.
+	NoTx bool
+
+	// LockTimeout and StatementTimeout are set in the migration's transaction, from
+	// the section's `lock_timeout` and `statement_timeout` modifiers.
+	LockTimeout      time.Duration
+	StatementTimeout time.Duration
+
+	// Go is true if the migration is a Go migration.
+	Go bool
+
+	// Repeatable is true if the migration is a repeatable migration whose SQL changed.
+	Repeatable bool
+
+	// Source names the source of the migration, if the options have Sources.
+	Source string
+}
+
+// Plan is the ordered list of migrations Apply or Rollback would run.
+type Plan []Step
+
+// Plan returns the migrations Apply would run, in order, along with the SQL for each,
+// without modifying the database schema.  It follows the same logic as Apply:  first
+// the migration files are applied or rolled back, then any embedded rollbacks are run,
+// and finally any repeatable migrations that changed.
+//
+// Like AtLatest, this function will create the metadata table if it doesn't exist.  With
+// Sources, plans each source in turn, to its latest revision.
+//
+// Returns a StoppedError if the plan would roll back an irreversible migration.
+func (options Options) Plan(ctx context.Context, span Span) (Plan, error) {
+	if len(options.Sources) > 0 {
+		return options.planSources(ctx, span)
+	}
+
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := options.reader()
+
+	direction := moving(ctx, span, metadataTable, options.source, options.Revision)
+	migrations, err := options.available(direction)
+	if err != nil {
+		return nil, err
+	}
+
+	if direction == Up {
+		if err := options.checkOutOfOrder(ctx, span, metadataTable, migrations); err != nil {
+			return nil, err
+		}
+	}
+
+	registered := options.goMigrations()
+
+	var plan Plan
+	planned := make(map[string]bool)
+
+	for _, migration := range migrations {
+		path := Join(options.Directory, migration)
+		if !ShouldRun(ctx, span, metadataTable, path, direction, options.Revision) {
+			continue
+		}
+
+		if _, ok := registered[migration]; ok {
+			plan = append(plan, Step{Migration: migration, Direction: direction, Go: true})
+			planned[migration] = true
+			continue
+		}
+
+		SQL, err := ReadSQL(reader, path, direction)
+		if err != nil {
+			return nil, err
+		}
+
+		section, err := ReadSection(reader, path, direction, options.Env)
+		if err != nil {
+			return nil, err
+		}
+
+		if direction == Down && section.Stop {
+			return nil, &StoppedError{Migration: migration}
+		}
+
+		// Recorded as applied without running the SQL
+		if direction == Up {
+			if squashes, err := squashCovered(ctx, span, metadataTable, reader, path); err != nil {
+				return nil, err
+			} else if len(squashes) > 0 {
+				continue
+			}
+		}
+
+		plan = append(plan, Step{
+			Migration: migration,
+			Direction: direction,
+			SQL:       strings.TrimSpace(SQL),
+			NoTx:      section.NoTx,
+
+			LockTimeout:      section.LockTimeout,
+			StatementTimeout: section.StatementTimeout,
+		})
+
+		planned[migration] = true
+	}
+
+	if options.EmbeddedRollbacks {
+		if plan, err = options.planRollbacks(ctx, span, metadataTable, plan, planned); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Revision != Latest {
+		return plan, nil
+	}
+
+	repeatables, err := options.pendingRepeatables(ctx, span, metadataTable)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range repeatables {
+		SQL, err := ReadSQL(reader, Join(options.Directory, migration), Up)
+		if err != nil {
+			return nil, err
+		}
+
+		plan = append(plan, Step{
+			Migration:  migration,
+			Direction:  Up,
+			SQL:        strings.TrimSpace(SQL),
+			Repeatable: true,
+		})
+	}
+
+	return plan, nil
+}
+
+// Adds the embedded rollbacks Apply would run to the plan.  Migrations already planned
+// to roll back using the migration file are skipped.
+func (options Options) planRollbacks(ctx context.Context, span Span, metadataTable string, plan Plan, planned map[string]bool) (Plan, error) {
+	registered := options.goMigrations()
+
+	revision := options.Revision
+	if revision == Latest {
+		revision = options.latestRevision()
+	}
+
+	rollbacks, err := rollbackSQL(ctx, span, metadataTable, options.source)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]string, 0, len(rollbacks))
+	for migration := range rollbacks {
+		applied = append(applied, migration)
+	}
+
+	sort.Sort(SortDown(applied))
+
+	for _, migration := range applied {
+		rev, err := Revision(migration)
+		if err != nil {
+			return nil, err
+		}
+
+		if rev <= revision {
+			break
+		}
+
+		// Already rolled back using the migration file
+		if planned[migration] {
+			continue
+		}
+
+		if _, ok := registered[migration]; ok {
+			plan = append(plan, Step{Migration: migration, Direction: Down, Go: true})
+			continue
+		}
+
+		rollback := rollbacks[migration]
+		if rollback.irreversible {
+			return nil, &StoppedError{Migration: migration}
+		}
+
+		if rollback.missing {
+			return nil, fmt.Errorf("unable to roll back %s: %w", migration, ErrRollbackUnavailable)
+		}
+
+		plan = append(plan, Step{
+			Migration: migration,
+			Direction: Down,
+			SQL:       rollback.downSQL,
+			Embedded:  true,
+		})
+	}
+
+	return plan, nil
+}
+
+// PlanRollback returns the migrations Rollback would run to roll back the number of
+// steps, without modifying the database schema.
+func (options Options) PlanRollback(ctx context.Context, span Span, steps int) (Plan, error) {
+	version, err := options.rollbackRevision(ctx, span, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	return options.WithRevision(version).Plan(ctx, span)
+}
+
+// Script renders the plan as a single SQL script for review.  Each migration is
+// preceded by a comment naming it and wrapped in a transaction, just as it would be
+// applied.  Non-transactional migrations aren't wrapped in a transaction.  Go migrations
+// are listed, but have no SQL.
+func (plan Plan) Script() string {
+	var b strings.Builder
+
+	for i, step := range plan {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		b.WriteString("-- ")
+		b.WriteString(step.Migration)
+		b.WriteString(" (")
+		b.WriteString(string(step.Direction))
+		if step.Embedded {
+			b.WriteString(", embedded rollback")
+		}
+		if step.NoTx {
+			b.WriteString(", notx")
+		}
+		if step.Go {
+			b.WriteString(", go")
+		}
+		if step.Repeatable {
+			b.WriteString(", repeatable")
+		}
+		b.WriteString(")\n")
+
+		if !step.NoTx {
+			b.WriteString("begin;\n")
+
+			for _, stmt := range timeoutStatements(step.LockTimeout, step.StatementTimeout) {
+				b.WriteString(stmt + ";\n")
+			}
+		}
+		if step.SQL != "" {
+			b.WriteString(step.SQL)
+			if !strings.HasSuffix(step.SQL, ";") && len(Split(step.SQL)) > 0 {
+				b.WriteString(";")
+			}
+			b.WriteString("\n")
+		}
+		if !step.NoTx {
+			b.WriteString("commit;\n")
+		}
+	}
+
+	return b.String()
+}
+
+// An embedded rollback in the metadata table.
+type embeddedRollback struct {
+	downSQL      string
+	irreversible bool
+	missing      bool // no rollback stored, e.g. for a Go migration
+}
+
+// Returns the source's embedded rollbacks in the metadata table, mapped by migration
+// filename.
+func rollbackSQL(ctx context.Context, span Span, metadataTable, source string) (map[string]embeddedRollback, error) {
+	rows, err := span.QueryMigration(ctx, "select migration, rollback, irreversible from "+metadataTable+" where squashed_by is null and not repeatable")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	results := make(map[string]embeddedRollback)
+
+	for rows.Next() {
+		var migration string
+		var rollback sql.NullString
+		var irreversible bool
+
+		if err := rows.Scan(&migration, &rollback, &irreversible); err != nil {
+			return nil, err
+		}
+
+		if !inSource(migration, source) {
+			continue
+		}
+
+		results[migration] = embeddedRollback{
+			downSQL:      rollback.String,
+			irreversible: irreversible,
+			missing:      !rollback.Valid,
+		}
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind rewrites the PostgreSQL-style `$1` placeholders in the migrations package's
+// queries into the `?` placeholders used by databases such as MySQL, for a Span
+// implementation to call before passing the query to its driver.  Since a `?` can't be
+// reused the way `$1` can, returns the args in the order of the placeholders, repeating
+// any args used more than once.
+//
+// Placeholders in quoted strings, quoted identifiers, and comments are left alone.  If
+// there are no args, returns the query as is, so migration SQL passes through unchanged.
+func Rebind(query string, args []any) (string, []any) {
+	if len(args) == 0 {
+		return query, args
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+
+	bound := make([]any, 0, len(args))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quoteEnd(query, i, c)
+			b.WriteString(query[i:end])
+			i = end - 1
+
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+
+			b.WriteString(query[i : i+end])
+			i += end - 1
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+
+			b.WriteString(query[i : i+end])
+			i += end - 1
+
+		case c == '$':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+
+			n, err := strconv.Atoi(query[i+1 : j])
+			if err != nil || n < 1 || n > len(args) {
+				b.WriteByte(c)
+				continue
+			}
+
+			b.WriteByte('?')
+			bound = append(bound, args[n-1])
+			i = j - 1
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), bound
+}
+
+// Returns the index just past the closing quote of the quoted string or identifier
+// starting at `start`.  A doubled quote is an escaped quote, as is a quote escaped with a
+// backslash in MySQL strings.  An unterminated quote runs to the end of the query.
+func quoteEnd(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(query)
+}
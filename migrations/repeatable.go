@@ -0,0 +1,190 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RepeatablePrefix identifies repeatable migration files, e.g. `R-views.sql`.  Repeatable
+// migrations have no revision.  They're run after the versioned migrations whenever
+// their "up" SQL changes, so views, functions, and triggers may be redefined in place
+// rather than copied into a new migration with every change.
+const RepeatablePrefix = "R-"
+
+// IsRepeatable returns true if the migration filename starts with the RepeatablePrefix.
+func IsRepeatable(path string) bool {
+	_, filename := SplitNamespace(Filename(path))
+	return strings.HasPrefix(filename, RepeatablePrefix)
+}
+
+// Repeatables returns the list of repeatable SQL migration paths, ordered by name.
+func Repeatables(reader Reader, directory string) ([]string, error) {
+	files, err := reader.Files(directory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid migrations directory, %s: %s", directory, err.Error())
+	}
+
+	var filenames []string
+	for _, name := range files {
+		if strings.HasSuffix(name, ".sql") && IsRepeatable(name) {
+			filenames = append(filenames, name)
+		}
+	}
+
+	sort.Strings(filenames)
+
+	return filenames, nil
+}
+
+// Returns the repeatable migrations whose "up" SQL has changed since they were last
+// applied, or that have never been applied, ordered by name.
+func (options Options) pendingRepeatables(ctx context.Context, span Span, metadataTable string) ([]string, error) {
+	repeatables, err := Repeatables(options.Reader, options.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, migration := range repeatables {
+		changed, err := repeatableChanged(ctx, span, options.Reader, metadataTable, Join(options.Directory, migration))
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// ApplyRepeatables runs each of the repeatable migrations in the directory whose "up"
+// SQL has changed since it was last applied, in order by name.
+func (m Migration) ApplyRepeatables(ctx context.Context, directory string) error {
+	repeatables, err := Repeatables(m.reader, directory)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range repeatables {
+		if err := m.ReadAndApplyRepeatable(ctx, Join(directory, migration)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadAndApplyRepeatable runs the "up" SQL of the repeatable migration in a transaction,
+// if it changed since it was last applied, and records its new checksum in the metadata
+// table.  Repeatable migrations may not be run outside a transaction.
+func (m Migration) ReadAndApplyRepeatable(ctx context.Context, path string) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer TxClose(ctx, tx)
+
+	if !m.advisory {
+		if err := lockMetadata(ctx, tx, m.metadataTable, m.lockWait); err != nil {
+			return err
+		}
+		defer tx.UnlockMetadata(ctx, m.metadataTable)
+	}
+
+	changed, err := repeatableChanged(ctx, tx, m.reader, m.metadataTable, path)
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		return tx.CommitMigration(ctx)
+	}
+
+	event := Event{Migration: Filename(path), Direction: Up}
+	start := time.Now()
+
+	m.emit(ctx, event.with(EventStart, 0, nil))
+
+	if err := m.applyRepeatable(ctx, tx, path); err != nil {
+		m.emit(ctx, event.with(EventFailure, time.Since(start), err))
+		return err
+	}
+
+	m.emit(ctx, event.with(EventFinish, time.Since(start), nil))
+	return nil
+}
+
+// Applies the repeatable migration in the transaction, replaces its record in the
+// metadata table, and commits it.
+func (m Migration) applyRepeatable(ctx context.Context, tx Span, path string) error {
+	section, err := ReadSection(m.reader, path, Up, m.env)
+	if err != nil {
+		return err
+	}
+
+	if section.NoTx {
+		return fmt.Errorf("unable to apply repeatable migration %s outside a transaction", Filename(path))
+	}
+
+	SQL, err := ReadSQL(m.reader, path, Up)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	if err := m.exec(ctx, tx, SQL); err != nil {
+		return fmt.Errorf("repeatable migration %s failed: %w", path, err)
+	}
+
+	checksum, err := Checksum(m.reader, path)
+	if err != nil {
+		return err
+	}
+
+	filename := Filename(path)
+
+	if err := tx.ExecMigration(ctx, "delete from "+m.metadataTable+" where migration = $1", filename); err != nil {
+		return err
+	}
+
+	if err := tx.ExecMigration(ctx, "insert into "+m.metadataTable+" (migration, checksum, repeatable) values ($1, $2, $3)", filename, checksum, true); err != nil {
+		return err
+	}
+
+	if err := RecordRun(ctx, tx, m.metadataTable, path, time.Since(start), m.appliedBy, m.env); err != nil {
+		return err
+	}
+
+	return tx.CommitMigration(ctx)
+}
+
+// Returns true if the repeatable migration's checksum differs from the one recorded in
+// the metadata table, or the migration has never been applied.
+func repeatableChanged(ctx context.Context, span Span, reader Reader, metadataTable, path string) (bool, error) {
+	checksum, err := Checksum(reader, path)
+	if err != nil {
+		return false, err
+	}
+
+	var recorded sql.NullString
+
+	row := span.QueryRowMigration(ctx, "select checksum from "+metadataTable+" where migration = $1", Filename(path))
+	if err := row.Scan(&recorded); errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return recorded.String != checksum, nil
+}
@@ -0,0 +1,171 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotReversible returned by CheckReversible if rolling back a migration doesn't
+	// restore the schema.  See ReversibleError for the details.
+	ErrNotReversible = errors.New("migration is not reversible")
+)
+
+// Fingerprint describes the database schema as a string, one schema object per line in a
+// stable order, so two fingerprints may be compared to see if the schema changed.  The
+// metadata table should be excluded.  See the sqlite package and the pgxtest package for
+// implementations.
+type Fingerprint func(ctx context.Context, span Span, metadataTable string) (string, error)
+
+// ReversibleError names the migration whose "down" SQL doesn't undo its "up" SQL, and the
+// difference in the schema after rolling it back.  errors.Is(err, ErrNotReversible)
+// returns true for a ReversibleError.
+type ReversibleError struct {
+	Migration string
+
+	// Diff lists the schema objects missing after the rollback, prefixed with "-", and
+	// those left behind by the rollback, prefixed with "+".
+	Diff string
+}
+
+// Error names the migration and shows the schema difference.
+func (e *ReversibleError) Error() string {
+	return fmt.Sprintf("%s: %s, the schema differs after rolling it back:\n%s", e.Migration, ErrNotReversible.Error(), e.Diff)
+}
+
+// Is matches ErrNotReversible.
+func (e *ReversibleError) Is(target error) bool {
+	return target == ErrNotReversible
+}
+
+// CheckReversible verifies each migration's "down" SQL undoes its "up" SQL.  One at a
+// time, each pending migration is applied, rolled back, and compared to the schema
+// fingerprint from before it was applied, then applied again before moving on to the
+// next migration.  Irreversible migrations (`/stop`) and Go migrations without a Down
+// function are applied, but not rolled back.
+//
+// Returns a ReversibleError for the first migration that doesn't restore the schema when
+// rolled back.  This is intended for tests, against an empty database:  the migrations
+// are left applied, up to the options' Revision.
+func (options Options) CheckReversible(ctx context.Context, span Span, fingerprint Fingerprint) error {
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := options.available(Up)
+	if err != nil {
+		return err
+	}
+
+	registered := options.goMigrations()
+	previous := 0
+
+	for _, migration := range migrations {
+		rev, err := Revision(migration)
+		if err != nil {
+			continue
+		}
+
+		if !IsUp(rev, options.Revision) {
+			break
+		}
+
+		if IsMigrated(ctx, span, metadataTable, migration) {
+			previous = rev
+			continue
+		}
+
+		before, err := fingerprint(ctx, span, metadataTable)
+		if err != nil {
+			return err
+		}
+
+		if err := options.WithRevision(rev).Apply(ctx, span); err != nil {
+			return err
+		}
+
+		reversible, err := options.reversible(migration, registered)
+		if err != nil {
+			return err
+		}
+
+		if !reversible {
+			previous = rev
+			continue
+		}
+
+		if err := options.WithRevision(previous).Apply(ctx, span); err != nil {
+			return fmt.Errorf("unable to roll back %s: %w", migration, err)
+		}
+
+		after, err := fingerprint(ctx, span, metadataTable)
+		if err != nil {
+			return err
+		}
+
+		if before != after {
+			return &ReversibleError{Migration: migration, Diff: diffLines(before, after)}
+		}
+
+		if err := options.WithRevision(rev).Apply(ctx, span); err != nil {
+			return fmt.Errorf("unable to reapply %s: %w", migration, err)
+		}
+
+		previous = rev
+	}
+
+	return nil
+}
+
+// Returns true if the migration may be rolled back, i.e. it's not marked `/stop` and it's
+// not a Go migration without a Down function.
+func (options Options) reversible(migration string, registered map[string]GoMigration) (bool, error) {
+	if gm, ok := registered[migration]; ok {
+		return gm.Down != nil, nil
+	}
+
+	section, err := ReadSection(options.Reader, Join(options.Directory, migration), Down, options.Env)
+	if err != nil {
+		return false, err
+	}
+
+	return !section.Stop, nil
+}
+
+// Compares two fingerprints line by line.  Lines only in the first are prefixed with "-",
+// and lines only in the second with "+".
+func diffLines(before, after string) string {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+
+	inBefore := make(map[string]bool, len(beforeLines))
+	for _, line := range beforeLines {
+		inBefore[line] = true
+	}
+
+	inAfter := make(map[string]bool, len(afterLines))
+	for _, line := range afterLines {
+		inAfter[line] = true
+	}
+
+	var diff []string
+	for _, line := range beforeLines {
+		if line != "" && !inAfter[line] {
+			diff = append(diff, "- "+line)
+		}
+	}
+
+	for _, line := range afterLines {
+		if line != "" && !inBefore[line] {
+			diff = append(diff, "+ "+line)
+		}
+	}
+
+	return strings.Join(diff, "\n")
+}
@@ -4,23 +4,49 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
-
-	"github.com/sbowman/drawbridge"
+	"time"
 )
 
 var (
 	// ErrRollbackComplete returned when the rollbacks are past the desired revision.
 	ErrRollbackComplete = errors.New("rollback complete")
+
+	// ErrStopped returned when rolling back a migration whose "down" section has the
+	// /stop modifier, i.e. the migration is irreversible.  See StoppedError.
+	ErrStopped = errors.New("migration is irreversible")
+
+	// ErrRollbackUnavailable returned if an applied migration has no embedded rollback,
+	// such as a Go migration with a Down function that is no longer registered.
+	ErrRollbackUnavailable = errors.New("no rollback available")
 )
 
-// UpdateRollback adds the migration's "down" SQL to the rollbacks table.
+// StoppedError names the irreversible migration that halted a rollback.
+// errors.Is(err, ErrStopped) returns true for a StoppedError.
+type StoppedError struct {
+	Migration string
+}
+
+// Error names the irreversible migration.
+func (e *StoppedError) Error() string {
+	return "rollback stopped at " + e.Migration + ": " + ErrStopped.Error()
+}
+
+// Is matches ErrStopped.
+func (e *StoppedError) Is(target error) bool {
+	return target == ErrStopped
+}
+
+// UpdateRollback adds the migration's "down" SQL to the rollbacks table, and whether the
+// migration is irreversible.  An irreversible migration's "down" section may be empty, so
+// its SQL isn't stored.
 func UpdateRollback(ctx context.Context, span Span, reader Reader, metadataTable, path string) error {
 	var err error
 	filename := Filename(path)
 
-	row := span.QueryRow(ctx, "select exists(select 1 from "+metadataTable+" where migration = $1)", filename)
+	row := span.QueryRowMigration(ctx, "select exists(select 1 from "+metadataTable+" where migration = $1)", filename)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return err
@@ -30,20 +56,26 @@ func UpdateRollback(ctx context.Context, span Span, reader Reader, metadataTable
 		return nil
 	}
 
-	downSQL, err := ReadSQL(reader, path, Down)
+	section, err := ReadSection(reader, path, Down, readerEnv(reader))
 	if err != nil {
 		return err
 	}
 
+	var downSQL string
+	if !section.Stop {
+		if downSQL, err = ReadSQL(reader, path, Down); err != nil {
+			return err
+		}
+	}
+
 	downSQL = strings.TrimSpace(downSQL)
-	_, err = span.Exec(ctx, "update "+metadataTable+" set rollback = $1 where migration = $2", downSQL, filename)
-	return err
+	return span.ExecMigration(ctx, "update "+metadataTable+" set rollback = $1, irreversible = $2 where migration = $3", downSQL, section.Stop, filename)
 }
 
 // ApplyRollbacks collects any migrations stored in the database that are higher than the
 // desired revision and runs the "down" migration to roll them back.
 func (m Migration) ApplyRollbacks(ctx context.Context) error {
-	migrations, err := Applied(ctx, m.span, m.metadataTable)
+	migrations, err := appliedMigrations(ctx, m.span, m.metadataTable, m.source)
 	if err != nil {
 		return err
 	}
@@ -63,12 +95,16 @@ func (m Migration) ApplyRollbacks(ctx context.Context) error {
 }
 
 // Rollback applies a "down" migration, provided it's greater than the desired revision.
+// Returns a StoppedError if the migration is irreversible.
+//
+// Go migrations are rolled back using their Down function if they're registered.
+// Otherwise, returns ErrRollbackUnavailable unless the Go migration had no Down function.
 func (m Migration) Rollback(ctx context.Context, migration string) error {
-	tx, err := Begin(ctx, m.span)
+	tx, err := m.begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer drawbridge.TxClose(ctx, tx)
+	defer TxClose(ctx, tx)
 
 	migrationRevision, err := Revision(migration)
 	if err != nil {
@@ -80,32 +116,72 @@ func (m Migration) Rollback(ctx context.Context, migration string) error {
 		return ErrRollbackComplete
 	}
 
-	var downSQL string
-	row := tx.QueryRow(ctx, "select rollback from "+m.metadataTable+" where migration = $1", migration)
-	if err := row.Scan(&downSQL); errors.Is(err, sql.ErrNoRows) {
-		return nil
-	} else if err != nil {
+	event := Event{Migration: migration, Direction: Down, Embedded: true}
+	start := time.Now()
+
+	m.emit(ctx, event.with(EventStart, 0, nil))
+
+	if err := m.rollback(ctx, tx, migration); err != nil {
+		m.emit(ctx, event.with(EventFailure, time.Since(start), err))
 		return err
 	}
 
-	if downSQL != "" {
-		_, err = tx.Exec(ctx, downSQL)
-		if err != nil {
+	m.emit(ctx, event.with(EventFinish, time.Since(start), nil))
+	return nil
+}
+
+// Rolls back the migration using the embedded rollback in the transaction and commits it.
+func (m Migration) rollback(ctx context.Context, tx Span, migration string) error {
+	if gm, ok := m.goMigrations[migration]; ok {
+		m.direction = Down
+		if err := m.applyGo(ctx, tx, gm); err != nil {
 			return err
 		}
+
+		return tx.CommitMigration(ctx)
+	}
+
+	var downSQL sql.NullString
+	var irreversible bool
+	row := tx.QueryRowMigration(ctx, "select rollback, irreversible from "+m.metadataTable+" where migration = $1", migration)
+	if err := row.Scan(&downSQL, &irreversible); errors.Is(err, sql.ErrNoRows) {
+		return tx.CommitMigration(ctx)
+	} else if err != nil {
+		return err
+	}
+
+	if irreversible {
+		return &StoppedError{Migration: migration}
+	}
+
+	if !downSQL.Valid {
+		return fmt.Errorf("unable to roll back %s: %w", migration, ErrRollbackUnavailable)
+	}
+
+	if downSQL.String != "" {
+		if err := m.exec(ctx, tx, downSQL.String); err != nil {
+			return fmt.Errorf("embedded rollback %s failed: %w", migration, err)
+		}
 	}
 
-	// Clean out the migration now that it's been rolled back
-	if _, err := tx.Exec(ctx, "delete from "+m.metadataTable+" where migration = $1", migration); err != nil {
+	// Clean out the migration now that it's been rolled back, along with any migrations
+	// squashed into it
+	if err := tx.ExecMigration(ctx, "delete from "+m.metadataTable+" where migration = $1 or squashed_by = $1", migration); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	return tx.CommitMigration(ctx)
 }
 
 // Applied returns the list of migrations that have already been applied to this database.
+// Repeatable migrations and migrations belonging to a Source aren't included.
 func Applied(ctx context.Context, span Span, metadataTable string) ([]string, error) {
-	rows, err := span.Query(ctx, "select migration from "+metadataTable)
+	return appliedMigrations(ctx, span, metadataTable, "")
+}
+
+// Returns the list of the source's migrations that have already been applied.
+func appliedMigrations(ctx context.Context, span Span, metadataTable, source string) ([]string, error) {
+	rows, err := span.QueryMigration(ctx, "select migration from "+metadataTable+" where squashed_by is null and not repeatable")
 	if err != nil {
 		return nil, err
 	}
@@ -121,10 +197,14 @@ func Applied(ctx context.Context, span Span, metadataTable string) ([]string, er
 			return nil, err
 		}
 
+		if !inSource(migration, source) {
+			continue
+		}
+
 		results = append(results, migration)
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
 // HandleEmbeddedRollbacks updates the rollbacks and then applies any missing and necessary
@@ -132,6 +212,12 @@ func Applied(ctx context.Context, span Span, metadataTable string) ([]string, er
 func (m Migration) HandleEmbeddedRollbacks(ctx context.Context, directory string) error {
 	if m.revision == Latest {
 		m.revision = LatestRevision(m.reader, directory)
+
+		for _, gm := range m.goMigrations {
+			if gm.Revision > m.revision {
+				m.revision = gm.Revision
+			}
+		}
 	}
 
 	// Apply the db-based rollbacks as needed
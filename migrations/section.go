@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Section describes the modifiers on the "up" or "down" section directive of a migration
+// file, e.g. `--- !Up notx`, `--- !Up env=dev,test`, or
+// `--- !Up lock_timeout=5s statement_timeout=10m retries=5`.  Unrecognized modifiers are
+// ignored; modifiers with invalid values are reported by ReadSection.
+type Section struct {
+	// Direction of the section.
+	Direction Direction
+
+	// NoTx indicates the section must be run outside a transaction (`notx`), such as
+	// for PostgreSQL's `CREATE INDEX CONCURRENTLY`.
+	NoTx bool
+
+	// Stop indicates the migration is irreversible (`/stop`), and rolling back past it
+	// must halt with a StoppedError.  Only meaningful on the "down" section.
+	Stop bool
+
+	// Env lists the environments the section runs in (`env=dev,test`).  If empty, the
+	// section runs in every environment.  See EnvReader.  Read with ReadSection, lists
+	// the environments of every section for the direction, whether or not they run in
+	// the environment read.
+	Env []string
+
+	// LockTimeout limits how long the section's statements wait for a lock
+	// (`lock_timeout=5s`), so a migration on a busy table fails rather than queue
+	// behind a long transaction and block the queries queued behind it.  Set with
+	// `SET LOCAL lock_timeout` in the migration's transaction.
+	LockTimeout time.Duration
+
+	// StatementTimeout limits how long each of the section's statements may run
+	// (`statement_timeout=10m`).  Set with `SET LOCAL statement_timeout` in the
+	// migration's transaction.
+	StatementTimeout time.Duration
+
+	// Retries is how many more times to try the migration's transaction if it fails
+	// waiting for a lock (`retries=5`), with an increasing delay between attempts.
+	Retries int
+
+	// The first modifier with an invalid value, e.g. `lock_timeout=5000`.
+	err error
+}
+
+// ErrInvalidModifier returned by ReadSection if a section directive has a modifier with
+// an invalid value, such as a timeout without a unit (`lock_timeout=5000`).
+var ErrInvalidModifier = errors.New("invalid section modifier")
+
+// InEnv returns true if the section runs in the environment, i.e. the section isn't
+// scoped to any environments, or the environment is one of them.
+func (section Section) InEnv(env string) bool {
+	if len(section.Env) == 0 {
+		return true
+	}
+
+	for _, e := range section.Env {
+		if strings.EqualFold(e, env) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadSection reads the modifiers on the migration's section directive for the direction,
+// in the environment.  If the migration contains more than one section for the direction,
+// the modifiers of the sections that run in the environment are combined, so a
+// `--- !Up env=dev notx` section doesn't take the migration outside a transaction in
+// production.  The Env lists the environments of all the sections, so a migration with
+// sections scoped to environments may be identified regardless.
+//
+// Returns ErrInvalidModifier if any section for the direction, in any environment, has a
+// modifier with an invalid value.
+func ReadSection(reader Reader, path string, direction Direction, env string) (Section, error) {
+	section := Section{Direction: direction}
+
+	f, err := reader.Read(path)
+	if err != nil {
+		return section, err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
+	}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		found := dirRe.FindStringSubmatch(s.Text())
+		if len(found) < 3 || Direction(strings.ToLower(found[1])) != direction {
+			continue
+		}
+
+		var scoped Section
+		scoped.parse(found[2])
+
+		if scoped.err != nil {
+			return section, fmt.Errorf("%s: %w", Filename(path), scoped.err)
+		}
+
+		section.Env = append(section.Env, scoped.Env...)
+
+		if scoped.InEnv(env) {
+			section.merge(scoped)
+		}
+	}
+
+	return section, s.Err()
+}
+
+// Combines the modifiers of another section for the same direction, other than its
+// environments.
+func (section *Section) merge(other Section) {
+	section.NoTx = section.NoTx || other.NoTx
+	section.Stop = section.Stop || other.Stop
+	section.LockTimeout = max(section.LockTimeout, other.LockTimeout)
+	section.StatementTimeout = max(section.StatementTimeout, other.StatementTimeout)
+	section.Retries = max(section.Retries, other.Retries)
+}
+
+// Parses the modifiers following the section directive, e.g. "notx", "/stop",
+// "env=dev,test", or "lock_timeout=5s".  Timeouts are Go durations, e.g. "500ms" or "10m".
+func (section *Section) parse(modifiers string) {
+	for _, modifier := range strings.Fields(modifiers) {
+		modifier = strings.ToLower(strings.TrimPrefix(modifier, "/"))
+
+		if name, value, ok := strings.Cut(modifier, "="); ok {
+			section.parseValue(name, value)
+			continue
+		}
+
+		switch modifier {
+		case "notx":
+			section.NoTx = true
+		case "stop":
+			section.Stop = true
+		}
+	}
+}
+
+// Parses a modifier with a value, e.g. "env=dev,test".  Records an invalid value as the
+// section's error, if it doesn't already have one.
+func (section *Section) parseValue(name, value string) {
+	if err := section.setValue(name, value); err != nil && section.err == nil {
+		section.err = fmt.Errorf("%w %s=%s: %w", ErrInvalidModifier, name, value, err)
+	}
+}
+
+// Sets the section's modifier to the value.  Timeouts and retries may not be negative.
+func (section *Section) setValue(name, value string) error {
+	switch name {
+	case "env":
+		for _, env := range strings.Split(value, ",") {
+			if env != "" {
+				section.Env = append(section.Env, env)
+			}
+		}
+	case "lock_timeout":
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return err
+		}
+
+		section.LockTimeout = timeout
+	case "statement_timeout":
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return err
+		}
+
+		section.StatementTimeout = timeout
+	case "retries":
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		if retries < 0 {
+			return errors.New("negative retries")
+		}
+
+		section.Retries = retries
+	}
+
+	return nil
+}
+
+// Parses a timeout modifier's Go duration, e.g. "500ms" or "10m".
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if timeout < 0 {
+		return 0, errors.New("negative timeout")
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,352 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// NamespaceSeparator separates a source's name from the filename of its migration in the
+// metadata table, e.g. `billing:3-add-invoices.sql`.
+const NamespaceSeparator = ":"
+
+var (
+	// ErrUnknownSource returned if a source is ordered after a source that isn't
+	// configured, or if Source is called with the name of a source that isn't
+	// configured.
+	ErrUnknownSource = errors.New("unknown migration source")
+
+	// ErrDuplicateSource returned if more than one source has the same name.
+	ErrDuplicateSource = errors.New("duplicate migration source")
+
+	// ErrInvalidSource returned if a source's name is blank or contains the
+	// NamespaceSeparator.
+	ErrInvalidSource = errors.New("invalid migration source name")
+
+	// ErrSourceCycle returned if the sources are ordered after one another in a cycle.
+	ErrSourceCycle = errors.New("migration sources are ordered in a cycle")
+
+	// ErrSourceRevision returned if migrating or rolling back the Sources to a
+	// revision.  Each source has its own revisions, so use Source to get the options
+	// for a single source instead.
+	ErrSourceRevision = errors.New("unable to migrate multiple sources to a revision")
+)
+
+// Source is a named set of migrations, such as the `sql/` directory of one Go module in
+// an application built from several modules.  The sources share the metadata table, with
+// each migration namespaced by its source name, e.g. `billing:3-add-invoices.sql`.  Each
+// source's revisions are tracked independently, so one source's revision 3 doesn't clash
+// with another's.
+type Source struct {
+	// Name identifies the source, and namespaces its migrations in the metadata table.
+	// It may not contain the NamespaceSeparator.
+	Name string
+
+	// Directory is the directory containing the source's SQL files.
+	Directory string
+
+	// Reader reads the source's migration files, e.g. an FSReader for migrations
+	// embedded in the module.  Defaults to the options' Reader.
+	Reader Reader
+
+	// GoMigrations are applied in revision order alongside the source's SQL migration
+	// files.
+	GoMigrations []GoMigration
+
+	// After lists the sources that must be migrated before this one, e.g. because
+	// this source's migrations reference their tables.
+	After []string
+}
+
+// WithSource adds a source of migrations.  Once any sources are added, Apply, AtLatest,
+// Plan, Status, and Validate work with the sources, in order, rather than the Directory.
+func WithSource(source Source) Options {
+	return DefaultOptions().WithSource(source)
+}
+
+// WithSource adds a source of migrations.  Once any sources are added, Apply, AtLatest,
+// Plan, Status, and Validate work with the sources, in order, rather than the Directory.
+func (options Options) WithSource(source Source) Options {
+	options.Sources = slices.Concat(options.Sources, []Source{source})
+	return options
+}
+
+// Source returns the options to work with just the named source, e.g. to migrate it to a
+// revision, roll it back, create a new migration in it, or baseline it.  Returns
+// ErrUnknownSource if there's no source with the name.
+func (options Options) Source(name string) (Options, error) {
+	for _, source := range options.Sources {
+		if source.Name == name {
+			return options.forSource(source), nil
+		}
+	}
+
+	return options, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+}
+
+// Returns the options for the source:  its directory, reader, and Go migrations, with its
+// migrations namespaced in the metadata table.  A legacy metadata table isn't adopted, as
+// it can't belong to every source.
+func (options Options) forSource(source Source) Options {
+	reader := options.Reader
+	if source.Reader != nil {
+		reader = source.Reader
+	}
+
+	options.Directory = source.Directory
+	options.Reader = &sourceReader{Reader: reader, source: source.Name}
+	options.GoMigrations = nil
+	options.Sources = nil
+	options.LegacyTables = nil
+	options.source = source.Name
+
+	for _, gm := range source.GoMigrations {
+		gm.source = source.Name
+		options.GoMigrations = append(options.GoMigrations, gm)
+	}
+
+	if options.Logger != nil {
+		options.Logger = options.Logger.With(AttrSource, source.Name)
+	}
+
+	return options
+}
+
+// SplitNamespace returns the source name and filename of a migration recorded in the
+// metadata table, e.g. "billing" and "3-add-invoices.sql" for
+// `billing:3-add-invoices.sql`.  The source is blank if the migration doesn't belong to a
+// Source.
+func SplitNamespace(migration string) (source, filename string) {
+	source, filename, found := strings.Cut(migration, NamespaceSeparator)
+	if !found {
+		return "", migration
+	}
+
+	return source, filename
+}
+
+// Returns the migration filename namespaced by the source, if any.
+func namespaced(source, filename string) string {
+	if source == "" {
+		return filename
+	}
+
+	return source + NamespaceSeparator + filename
+}
+
+// Returns true if the migration recorded in the metadata table belongs to the source, or
+// to no source if the source is blank.
+func inSource(migration, source string) bool {
+	ns, _ := SplitNamespace(migration)
+	return ns == source
+}
+
+// Wraps a source's Reader to namespace its migration filenames, so the migrations are
+// recorded in the metadata table with the source name.
+type sourceReader struct {
+	Reader
+
+	source string
+}
+
+// Files returns the filenames in the directory, namespaced by the source.
+func (r *sourceReader) Files(directory string) ([]string, error) {
+	files, err := r.Reader.Files(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, namespaced(r.source, file))
+	}
+
+	return paths, nil
+}
+
+// Read the migration, removing the source's namespace from its filename.
+func (r *sourceReader) Read(path string) (io.Reader, error) {
+	path = filepath.ToSlash(path)
+	dir := path[:strings.LastIndex(path, "/")+1]
+
+	_, filename := SplitNamespace(Filename(path))
+	return r.Reader.Read(dir + filename)
+}
+
+// Returns the sources in the order they should be migrated.  Sources are migrated in the
+// order they were added, except a source is always migrated after the sources it's
+// ordered After.
+func (options Options) orderedSources() ([]Source, error) {
+	byName := make(map[string]bool, len(options.Sources))
+	for _, source := range options.Sources {
+		if source.Name == "" || strings.Contains(source.Name, NamespaceSeparator) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSource, source.Name)
+		}
+
+		if byName[source.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateSource, source.Name)
+		}
+
+		byName[source.Name] = true
+	}
+
+	for _, source := range options.Sources {
+		for _, after := range source.After {
+			if !byName[after] {
+				return nil, fmt.Errorf("source %s is ordered after %s: %w", source.Name, after, ErrUnknownSource)
+			}
+		}
+	}
+
+	ordered := make([]Source, 0, len(options.Sources))
+	placed := make(map[string]bool, len(options.Sources))
+
+	for len(ordered) < len(options.Sources) {
+		next := -1
+
+		for i, source := range options.Sources {
+			if placed[source.Name] {
+				continue
+			}
+
+			ready := true
+			for _, after := range source.After {
+				if !placed[after] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			var remaining []string
+			for _, source := range options.Sources {
+				if !placed[source.Name] {
+					remaining = append(remaining, source.Name)
+				}
+			}
+
+			return nil, fmt.Errorf("%w: %s", ErrSourceCycle, strings.Join(remaining, ", "))
+		}
+
+		ordered = append(ordered, options.Sources[next])
+		placed[options.Sources[next].Name] = true
+	}
+
+	return ordered, nil
+}
+
+// Applies the migrations from each source, in order, to its latest revision.
+func (options Options) applySources(ctx context.Context, span Span) error {
+	if options.Revision != Latest {
+		return ErrSourceRevision
+	}
+
+	sources, err := options.orderedSources()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		if err := options.forSource(source).Apply(ctx, span); err != nil {
+			return fmt.Errorf("source %s: %w", source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Checks each source is at its latest revision.
+func (options Options) sourcesAtLatest(ctx context.Context, span Span) error {
+	sources, err := options.orderedSources()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		if err := options.forSource(source).AtLatest(ctx, span); err != nil {
+			return fmt.Errorf("source %s: %w", source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Plans the migrations for each source, in order, to its latest revision.
+func (options Options) planSources(ctx context.Context, span Span) (Plan, error) {
+	if options.Revision != Latest {
+		return nil, ErrSourceRevision
+	}
+
+	sources, err := options.orderedSources()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan Plan
+
+	for _, source := range sources {
+		steps, err := options.forSource(source).Plan(ctx, span)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+
+		for _, step := range steps {
+			step.Source = source.Name
+			plan = append(plan, step)
+		}
+	}
+
+	return plan, nil
+}
+
+// Reports the status of each source's migrations, in order.
+func (options Options) sourcesStatus(ctx context.Context, span Span) ([]MigrationStatus, error) {
+	sources, err := options.orderedSources()
+	if err != nil {
+		return nil, err
+	}
+
+	var report []MigrationStatus
+
+	for _, source := range sources {
+		statuses, err := options.forSource(source).Status(ctx, span)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+
+		for _, status := range statuses {
+			status.Source = source.Name
+			report = append(report, status)
+		}
+	}
+
+	return report, nil
+}
+
+// Validates the migration files of each source.
+func (options Options) validateSources() error {
+	sources, err := options.orderedSources()
+	if err != nil {
+		return err
+	}
+
+	var problems []error
+
+	for _, source := range sources {
+		if err := options.forSource(source).Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("source %s: %w", source.Name, err))
+		}
+	}
+
+	return errors.Join(problems...)
+}
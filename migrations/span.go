@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/sbowman/drawbridge"
+)
+
+// Span is the backend-neutral interface the migrations package uses to apply migrations
+// and manage the metadata table.  The connections and transactions in the postgres,
+// postgres/std, sqlite, and mysql packages all implement it, so any of them may be passed
+// directly to [Options.Apply].
+//
+// The transaction and query functions are named separately from the [drawbridge.Span]
+// and [postgres.Span] functions, since those return driver-specific results.
+//
+// The migrations package's queries use PostgreSQL-style `$1` placeholders.  A Span for a
+// database that uses `?` placeholders, such as MySQL, rewrites them with [Rebind].
+type Span interface {
+	// CreateMetadata verifies if the schema and table exists, and if they don't, it
+	// creates them.  Returns the name to use for the database queries related to
+	// the migrations.  For example, if the schema is `drawbridge` and the table is
+	// `schema_migrations`, CreateMetadata would return `drawbridge.schema_migrations`.
+	CreateMetadata(ctx context.Context, schema, table string) (string, error)
+
+	// LockMetadata locks the migrations package's metadata table to prevent other
+	// processes from applying migrations.
+	LockMetadata(ctx context.Context, metadataTable string) error
+
+	// UnlockMetadata unlocks the migrations package's metadata table.  Some databases
+	// require an unlock, whereas other databases unlock the table at the end of the
+	// transaction, so this may do nothing.
+	UnlockMetadata(ctx context.Context, metadataTable string)
+
+	// InTx returns true if this Span is a transaction.
+	InTx() bool
+
+	// BeginMigration starts a transaction.  If the Span is already a transaction,
+	// starts a nested transaction or savepoint, if supported.
+	BeginMigration(ctx context.Context) (Span, error)
+
+	// CommitMigration commits a transaction started with BeginMigration.  Does nothing
+	// if the Span isn't a transaction.
+	CommitMigration(ctx context.Context) error
+
+	// CloseMigration rolls back a transaction started with BeginMigration, provided
+	// it hasn't been committed.  Safe to call after CommitMigration, so it may be
+	// deferred.
+	CloseMigration(ctx context.Context) error
+
+	// ExecMigration executes SQL without returning any rows.  The args are for any
+	// placeholder parameters in the query.
+	ExecMigration(ctx context.Context, sql string, args ...any) error
+
+	// QueryMigration executes a query that returns rows.  Be sure to close the Rows
+	// when finished with them.
+	QueryMigration(ctx context.Context, sql string, args ...any) (Rows, error)
+
+	// QueryRowMigration executes a query that is expected to return at most one row.
+	// Errors are deferred until the Row's Scan method is called.  If the query selects
+	// no rows, Scan returns an error where errors.Is(err, sql.ErrNoRows) is true.
+	QueryRowMigration(ctx context.Context, sql string, args ...any) Row
+}
+
+// Row is the result of calling [Span.QueryRowMigration].  Both [sql.Row] and [pgx.Row]
+// satisfy it.
+type Row interface {
+	// Scan copies the columns from the matched row into the values pointed at by dest.
+	Scan(dest ...any) error
+}
+
+// Rows is the result of calling [Span.QueryMigration].  It matches the [sql.Rows]
+// functions used by the migrations package.
+type Rows interface {
+	// Next prepares the next result row for reading with Scan.  Returns false when
+	// there are no more rows or an error occurred.
+	Next() bool
+
+	// Scan copies the columns in the current row into the values pointed at by dest.
+	Scan(dest ...any) error
+
+	// Err returns the error, if any, that was encountered during iteration.
+	Err() error
+
+	// Close the rows, releasing the connection.
+	Close() error
+}
+
+// FromSpan returns the [drawbridge.Span] as a [Span], or ErrInvalidSpan if it doesn't
+// implement Span.  Before Span was backend-neutral, it embedded drawbridge.Span and the
+// migrations functions accepted one; use FromSpan to migrate code still passing a
+// drawbridge.Span.
+//
+// Deprecated: pass the connection or transaction, e.g. a *std.DB, directly.
+func FromSpan(span drawbridge.Span) (Span, error) {
+	mspan, ok := span.(Span)
+	if !ok {
+		return nil, ErrInvalidSpan
+	}
+
+	return mspan, nil
+}
+
+// Begin is a helper function to create a transaction for a migration from a [Span].
+func Begin(ctx context.Context, span Span) (Span, error) {
+	return span.BeginMigration(ctx)
+}
+
+// TxClose is a shorthand function to use in a defer statement.  If the transaction fails
+// to close (commit or rollback), the function panics.
+func TxClose(ctx context.Context, tx Span) {
+	err := tx.CloseMigration(ctx)
+	if err == nil {
+		return
+	}
+
+	panic("Transaction failed to close: " + err.Error())
+}
@@ -0,0 +1,338 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StatementError is returned when a migration is run statement by statement and one of
+// the statements fails.  Unwraps to the database error.
+type StatementError struct {
+	// Index is the position of the failed statement in the section, starting at 1.
+	Index int
+
+	// Statement is the SQL of the failed statement.
+	Statement string
+
+	// Err is the error returned by the database.
+	Err error
+}
+
+// Error identifies the failed statement by its position and first line.
+func (e *StatementError) Error() string {
+	first, _, _ := strings.Cut(e.Statement, "\n")
+	if len(first) > 60 {
+		first = first[:60] + "..."
+	}
+
+	return fmt.Sprintf("statement %d (%s) failed: %s", e.Index, first, e.Err)
+}
+
+// Unwrap returns the database error.
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// BackslashEscaper is implemented by a Span for a database whose string literals escape
+// quotes with a backslash by default, such as MySQL, so the migrations are split into
+// statements with SplitBackslashEscapes.
+type BackslashEscaper interface {
+	// BackslashEscapes returns true if a backslash escapes the next character in a
+	// string literal.
+	BackslashEscapes() bool
+}
+
+// Split separates the SQL into individual statements on the semicolons.  Semicolons in
+// comments (`--` and `/* */`), string literals (including `E'...'` strings with backslash
+// escapes), quoted identifiers, and dollar-quoted (`$$` or `$tag$`) bodies are ignored,
+// as are semicolons in the `BEGIN ... END` block of a `CREATE TRIGGER`, `CREATE FUNCTION`,
+// or `CREATE PROCEDURE` statement, e.g. in a SQLite trigger.  In a block, `END IF`,
+// `END LOOP`, `END WHILE`, `END REPEAT`, and `END CASE` close the control flow statement,
+// not the block, as in a MySQL stored procedure.
+//
+// Backslashes in ordinary string literals are plain characters, as in PostgreSQL and
+// SQLite.  For MySQL, see SplitBackslashEscapes; migrations applied to a Span that
+// implements BackslashEscaper are split with it.
+//
+// The statements are returned without their trailing semicolons.  Empty statements, or
+// statements that contain only comments, are dropped.
+func Split(SQL string) []string {
+	return split(SQL, false)
+}
+
+// SplitBackslashEscapes separates the SQL into individual statements like Split, but a
+// backslash escapes the next character in every string literal, e.g. `'it\'s'`, as in
+// MySQL.
+func SplitBackslashEscapes(SQL string) []string {
+	return split(SQL, true)
+}
+
+// Splits the SQL into statements the way the database parses them, i.e. with backslash
+// escapes if the Span is a BackslashEscaper.
+func splitFor(span Span, SQL string) []string {
+	if escaper, ok := span.(BackslashEscaper); ok && escaper.BackslashEscapes() {
+		return SplitBackslashEscapes(SQL)
+	}
+
+	return Split(SQL)
+}
+
+// Splits the SQL into statements, as described by Split.  If `backslashes` is true, a
+// backslash escapes the next character in any string literal.
+func split(SQL string, backslashes bool) []string {
+	var statements []string
+
+	start := 0
+	content := false // does the statement contain anything other than comments?
+	words := 0       // number of words in the statement so far
+	first := ""      // first word in the statement
+	blocks := false  // may the statement contain BEGIN ... END blocks?
+	depth := 0       // BEGIN ... END block depth
+
+	n := len(SQL)
+	for i := 0; i < n; {
+		c := SQL[i]
+
+		switch {
+		case c == '-' && i+1 < n && SQL[i+1] == '-':
+			if end := strings.IndexByte(SQL[i:], '\n'); end < 0 {
+				i = n
+			} else {
+				i += end + 1
+			}
+
+		case c == '/' && i+1 < n && SQL[i+1] == '*':
+			i = skipBlockComment(SQL, i)
+
+		case c == '\'':
+			content = true
+			i = skipString(SQL, i, '\'', backslashes)
+
+		case c == '"' && backslashes:
+			// MySQL's double-quoted strings escape quotes with a backslash, too
+			content = true
+			i = skipString(SQL, i, c, true)
+
+		case c == '"' || c == '`':
+			content = true
+			i = skipQuoted(SQL, i, c)
+
+		case c == '$':
+			content = true
+			if tag := dollarTag(SQL, i); tag != "" {
+				if end := strings.Index(SQL[i+len(tag):], tag); end < 0 {
+					i = n
+				} else {
+					i += len(tag) + end + len(tag)
+				}
+			} else {
+				i++
+			}
+
+		case isIdentStart(c):
+			content = true
+
+			j := i + 1
+			for j < n && isIdent(SQL[j]) {
+				j++
+			}
+
+			word := strings.ToLower(SQL[i:j])
+
+			// E'...' strings support backslash escapes
+			if word == "e" && j < n && SQL[j] == '\'' {
+				i = skipString(SQL, j, '\'', true)
+				continue
+			}
+
+			words++
+			if words == 1 {
+				first = word
+			}
+
+			switch word {
+			case "trigger", "function", "procedure":
+				// e.g. "create or replace temporary trigger"
+				if first == "create" && words <= 5 {
+					blocks = true
+				}
+			case "begin":
+				if blocks {
+					depth++
+				}
+			case "case":
+				if depth > 0 {
+					depth++
+				}
+			case "end":
+				if depth == 0 {
+					break
+				}
+
+				// END IF, END LOOP, etc. close a statement inside the block; END CASE
+				// closes the CASE counted above
+				next, k := nextWord(SQL, j)
+				switch next {
+				case "if", "loop", "while", "repeat":
+					j = k
+				case "case":
+					j = k
+					depth--
+				default:
+					depth--
+				}
+			}
+
+			i = j
+
+		case c == ';' && depth == 0:
+			if content {
+				statements = append(statements, strings.TrimSpace(SQL[start:i]))
+			}
+
+			i++
+			start = i
+			content, words, first, blocks = false, 0, "", false
+
+		default:
+			if !isSpace(c) {
+				content = true
+			}
+			i++
+		}
+	}
+
+	if content {
+		statements = append(statements, strings.TrimSpace(SQL[start:]))
+	}
+
+	return statements
+}
+
+// Runs the SQL statement by statement, returning a StatementError if one fails.
+func execStatements(ctx context.Context, span Span, SQL string) error {
+	for i, statement := range splitFor(span, SQL) {
+		if err := span.ExecMigration(ctx, statement); err != nil {
+			return &StatementError{Index: i + 1, Statement: statement, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Returns the index just past the end of the block comment starting at `i`.  Block
+// comments may be nested, as in PostgreSQL.
+func skipBlockComment(SQL string, i int) int {
+	depth := 0
+
+	for n := len(SQL); i < n; {
+		switch {
+		case SQL[i] == '/' && i+1 < n && SQL[i+1] == '*':
+			depth++
+			i += 2
+		case SQL[i] == '*' && i+1 < n && SQL[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+
+	return len(SQL)
+}
+
+// Returns the index just past the end of the string literal starting at `i` and enclosed
+// in the quote.  Quotes are escaped by doubling them, or with a backslash if
+// `backslashes` is true.
+func skipString(SQL string, i int, quote byte, backslashes bool) int {
+	for i, n := i+1, len(SQL); i < n; i++ {
+		switch SQL[i] {
+		case '\\':
+			if backslashes {
+				i++
+			}
+		case quote:
+			if i+1 < n && SQL[i+1] == quote {
+				i++
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(SQL)
+}
+
+// Returns the index just past the end of the quoted identifier starting at `i`.
+func skipQuoted(SQL string, i int, quote byte) int {
+	for i, n := i+1, len(SQL); i < n; i++ {
+		if SQL[i] != quote {
+			continue
+		}
+
+		if i+1 < n && SQL[i+1] == quote {
+			i++
+			continue
+		}
+
+		return i + 1
+	}
+
+	return len(SQL)
+}
+
+// Returns the dollar-quote tag, e.g. "$$" or "$body$", starting at `i`, or a blank string
+// if `i` isn't the start of a tag, such as a "$1" parameter.
+func dollarTag(SQL string, i int) string {
+	j := i + 1
+	if j < len(SQL) && isIdentStart(SQL[j]) {
+		for j < len(SQL) && isIdent(SQL[j]) && SQL[j] != '$' {
+			j++
+		}
+	}
+
+	if j < len(SQL) && SQL[j] == '$' {
+		return SQL[i : j+1]
+	}
+
+	return ""
+}
+
+// Returns the next word after `i`, in lowercase, and the index just past it, skipping
+// any whitespace.  If the next thing isn't a word, returns a blank string.
+func nextWord(SQL string, i int) (string, int) {
+	for i < len(SQL) && isSpace(SQL[i]) {
+		i++
+	}
+
+	if i >= len(SQL) || !isIdentStart(SQL[i]) {
+		return "", i
+	}
+
+	j := i + 1
+	for j < len(SQL) && isIdent(SQL[j]) {
+		j++
+	}
+
+	return strings.ToLower(SQL[i:j]), j
+}
+
+// Can the character start an identifier or keyword?  Bytes of multibyte UTF-8 characters
+// are treated as identifier characters.
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// Can the character continue an identifier or keyword?
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
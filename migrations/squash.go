@@ -0,0 +1,254 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNothingToSquash returned by Squash if there are fewer than two migrations to
+	// squash.
+	ErrNothingToSquash = errors.New("nothing to squash")
+
+	// ErrPartialSquash returned if the database has applied some, but not all, of the
+	// migrations replaced by a squashed migration.  Apply the original migrations to
+	// the database before applying the squashed migration.
+	ErrPartialSquash = errors.New("database has applied only some of the squashed migrations")
+
+	// Matches the list of migrations replaced by a squashed migration
+	squashRe = regexp.MustCompile(`^---\s+!Squashes\s+(.*)$`)
+)
+
+// Squash concatenates the "up" sections of the migration files up to and including the
+// revision into a single new migration file, with the "down" sections in reverse order.
+// The new file is named for the latest revision squashed, e.g. `42-squashed.sql`, and
+// lists the migrations it replaces in `--- !Squashes` headers.  The original migration
+// files are removed.  Returns the full path to the squashed file.
+//
+// When Apply encounters the squashed migration, a database that already applied all the
+// original migrations records the squashed migration as applied without running it, and
+// marks the originals as squashed by it in the metadata table.  A new database simply
+// runs the squashed migration.
+//
+// Like Create, the files are read using the options' Reader, but written to and removed
+// from the Directory on disk.  Go migrations, non-transactional migrations, and migrations
+// with sections scoped to environments may not be squashed.
+func (options Options) Squash(upTo int) (string, error) {
+	available, err := options.available(Up)
+	if err != nil {
+		return "", err
+	}
+
+	registered := options.goMigrations()
+
+	var squashed []string
+	var revision int
+
+	for _, migration := range available {
+		rev, err := Revision(migration)
+		if err != nil || rev > upTo {
+			continue
+		}
+
+		if _, ok := registered[migration]; ok {
+			return "", fmt.Errorf("unable to squash Go migration %s", migration)
+		}
+
+		squashed = append(squashed, migration)
+		revision = rev
+	}
+
+	if len(squashed) < 2 {
+		return "", ErrNothingToSquash
+	}
+
+	var header, up strings.Builder
+	var downs []string
+	var stop bool
+
+	for _, migration := range squashed {
+		path := Join(options.Directory, migration)
+
+		var irreversible bool
+		for _, direction := range []Direction{Up, Down} {
+			section, err := ReadSection(options.Reader, path, direction, options.Env)
+			if err != nil {
+				return "", err
+			}
+
+			if section.NoTx {
+				return "", fmt.Errorf("unable to squash non-transactional migration %s", migration)
+			}
+
+			if len(section.Env) > 0 {
+				return "", fmt.Errorf("unable to squash migration %s with sections scoped to environments", migration)
+			}
+
+			irreversible = irreversible || section.Stop
+		}
+
+		stop = stop || irreversible
+
+		upSQL, err := ReadSQL(options.Reader, path, Up)
+		if err != nil {
+			return "", err
+		}
+
+		// An irreversible migration's "down" section may be empty
+		var downSQL string
+		if !irreversible {
+			if downSQL, err = ReadSQL(options.Reader, path, Down); err != nil {
+				return "", err
+			}
+		}
+
+		// Within a source, the files list the migrations without the source's namespace
+		_, filename := SplitNamespace(migration)
+
+		header.WriteString("--- !Squashes " + filename + "\n")
+		up.WriteString(squashSection(filename, upSQL))
+		downs = append(downs, squashSection(filename, downSQL))
+	}
+
+	var b strings.Builder
+	b.WriteString(header.String())
+	b.WriteString("\n--- !Up\n")
+	b.WriteString(up.String())
+
+	b.WriteString("\n--- !Down")
+	if stop {
+		b.WriteString(" /stop")
+	}
+	b.WriteString("\n")
+
+	for i := len(downs) - 1; i >= 0; i-- {
+		b.WriteString(downs[i])
+	}
+
+	path := filepath.Join(options.Directory, fmt.Sprintf("%d-squashed.sql", revision))
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+
+	for _, migration := range squashed {
+		_, filename := SplitNamespace(migration)
+		if filepath.Join(options.Directory, filename) == path {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(options.Directory, filename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return path, err
+		}
+	}
+
+	return path, nil
+}
+
+// ReadSquashes returns the migrations replaced by a squashed migration, listed in its
+// `--- !Squashes` headers.  Returns nil if the migration isn't a squashed migration.
+func ReadSquashes(reader Reader, path string) ([]string, error) {
+	f, err := reader.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
+	}
+
+	var squashes []string
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if found := squashRe.FindStringSubmatch(s.Text()); len(found) > 1 {
+			squashes = append(squashes, strings.Fields(found[1])...)
+		}
+	}
+
+	return squashes, s.Err()
+}
+
+// If the migration is a squashed migration and the database already applied the
+// migrations it replaces, records the squashed migration as applied and marks the
+// originals as squashed by it.  Returns true if the squashed migration was recorded, so
+// its SQL should not be run.
+func (m Migration) applySquashed(ctx context.Context, tx Span, path string) (bool, error) {
+	squashes, err := squashCovered(ctx, tx, m.metadataTable, m.reader, path)
+	if err != nil || len(squashes) == 0 {
+		return false, err
+	}
+
+	if err := Migrated(ctx, tx, m.reader, m.metadataTable, path, Up, m.rollbacks); err != nil {
+		return false, err
+	}
+
+	if err := RecordRun(ctx, tx, m.metadataTable, path, 0, m.appliedBy, m.env); err != nil {
+		return false, err
+	}
+
+	for _, migration := range squashes {
+		if err := tx.ExecMigration(ctx, "update "+m.metadataTable+" set squashed_by = $1 where migration = $2", Filename(path), migration); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// If the migration is a squashed migration and the database already applied the
+// migrations it replaces, returns those migrations.  Returns nil if the migration isn't a
+// squashed migration or the database applied none of the migrations it replaces.
+// Returns ErrPartialSquash if the database applied only some of them.
+func squashCovered(ctx context.Context, span Span, metadataTable string, reader Reader, path string) ([]string, error) {
+	squashes, err := ReadSquashes(reader, path)
+	if err != nil || len(squashes) == 0 {
+		return nil, err
+	}
+
+	// A source's squashed migration replaces migrations in the same source
+	source, _ := SplitNamespace(Filename(path))
+	for i, migration := range squashes {
+		squashes[i] = namespaced(source, migration)
+	}
+
+	var applied []string
+	for _, migration := range squashes {
+		if IsMigrated(ctx, span, metadataTable, migration) {
+			applied = append(applied, migration)
+		}
+	}
+
+	switch len(applied) {
+	case 0:
+		return nil, nil
+	case len(squashes):
+		return squashes, nil
+	}
+
+	return nil, fmt.Errorf("unable to apply %s, applied only %s: %w", Filename(path), strings.Join(applied, ", "), ErrPartialSquash)
+}
+
+// Returns the migration's SQL as a section of the squashed migration, preceded by a
+// comment naming the migration.  Each statement is terminated, so the sections may be
+// safely concatenated.
+func squashSection(migration, SQL string) string {
+	var b strings.Builder
+	b.WriteString("-- " + migration + "\n")
+
+	for _, statement := range Split(SQL) {
+		b.WriteString(statement + ";\n")
+	}
+
+	b.WriteString("\n")
+	return b.String()
+}
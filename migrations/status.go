@@ -0,0 +1,196 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// State classifies a migration in the [Options.Status] report.
+type State string
+
+const (
+	// StateApplied indicates the migration file has been applied to the database.
+	StateApplied State = "applied"
+
+	// StatePending indicates the migration file has not yet been applied to the
+	// database.
+	StatePending State = "pending"
+
+	// StateMissing indicates the migration was applied to the database, but the
+	// migration file is no longer available.  The migration may only be rolled back
+	// using the embedded rollback SQL.
+	StateMissing State = "missing"
+
+	// StateOutOfOrder indicates the migration file has not been applied to the
+	// database, but a migration with a higher revision has been.
+	StateOutOfOrder State = "out-of-order"
+)
+
+// MigrationStatus reports the state of a single migration.
+type MigrationStatus struct {
+	// Migration is the filename of the migration, e.g. `1-create-users.sql`.
+	Migration string
+
+	// Source names the source of the migration, if the options have Sources.
+	Source string
+
+	// Revision is the revision number parsed from the migration filename.
+	Revision int
+
+	// State classifies the migration as applied, pending, missing, or out of order.
+	State State
+
+	// EmbeddedRollback is true if the rollback SQL for the migration is stored in
+	// the metadata table.
+	EmbeddedRollback bool
+
+	// AppliedAt is when the migration was applied.  Zero if the migration hasn't been
+	// applied, or was applied before the metadata table recorded it.
+	AppliedAt time.Time
+
+	// Duration is how long the migration took to apply.
+	Duration time.Duration
+
+	// AppliedBy identifies who or what applied the migration.
+	AppliedBy string
+
+	// Env is the environment the migration was applied in, if any.
+	Env string
+
+	// Dirty is true if the migration ran outside a transaction and failed partway, or
+	// is still being applied.  See ClearDirty.
+	Dirty bool
+}
+
+// Status returns a report on each migration, in revision order, combining the migration
+// files available to the options' Reader and the Go migrations with the migrations
+// recorded in the metadata table.  Files whose names don't include a valid revision are
+// ignored.  With Sources, reports on each source in turn.
+//
+// Like AtLatest, this function does not apply any migrations, though it will create the
+// metadata table if it doesn't exist.
+func (options Options) Status(ctx context.Context, span Span) ([]MigrationStatus, error) {
+	if len(options.Sources) > 0 {
+		return options.sourcesStatus(ctx, span)
+	}
+
+	schema := options.MetadataTable.Schema
+	table := options.MetadataTable.Name
+
+	metadataTable, err := span.CreateMetadata(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := options.available(Up)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedRecords(ctx, span, metadataTable, options.source)
+	if err != nil {
+		return nil, err
+	}
+
+	latestApplied := 0
+	for migration := range applied {
+		if rev, err := Revision(migration); err == nil && rev > latestApplied {
+			latestApplied = rev
+		}
+	}
+
+	var report []MigrationStatus
+	found := make(map[string]bool)
+
+	for _, migration := range available {
+		rev, err := Revision(migration)
+		if err != nil {
+			continue
+		}
+
+		found[migration] = true
+
+		status := MigrationStatus{
+			Migration: migration,
+			Revision:  rev,
+		}
+
+		if record, ok := applied[migration]; ok {
+			status = record
+			status.Revision = rev
+			status.State = StateApplied
+		} else if rev < latestApplied {
+			status.State = StateOutOfOrder
+		} else {
+			status.State = StatePending
+		}
+
+		report = append(report, status)
+	}
+
+	for migration, record := range applied {
+		if found[migration] {
+			continue
+		}
+
+		rev, err := Revision(migration)
+		if err != nil {
+			continue
+		}
+
+		record.Revision = rev
+		record.State = StateMissing
+
+		report = append(report, record)
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Revision < report[j].Revision
+	})
+
+	return report, nil
+}
+
+// Returns the source's migrations recorded in the metadata table, mapped by migration
+// filename.
+func appliedRecords(ctx context.Context, span Span, metadataTable, source string) (map[string]MigrationStatus, error) {
+	rows, err := span.QueryMigration(ctx, "select migration, rollback, applied_at, duration_ms, applied_by, dirty, env from "+metadataTable+" where squashed_by is null and not repeatable")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	results := make(map[string]MigrationStatus)
+
+	for rows.Next() {
+		var migration string
+		var rollback, appliedBy, env sql.NullString
+		var appliedAt sql.NullTime
+		var duration sql.NullInt64
+		var dirty sql.NullBool
+
+		if err := rows.Scan(&migration, &rollback, &appliedAt, &duration, &appliedBy, &dirty, &env); err != nil {
+			return nil, err
+		}
+
+		if !inSource(migration, source) {
+			continue
+		}
+
+		results[migration] = MigrationStatus{
+			Migration:        migration,
+			EmbeddedRollback: rollback.Valid,
+			AppliedAt:        appliedAt.Time,
+			Duration:         time.Duration(duration.Int64) * time.Millisecond,
+			AppliedBy:        appliedBy.String,
+			Dirty:            dirty.Bool,
+			Env:              env.String,
+		}
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,190 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTenantPanic is the TenantResult's error if migrating the tenant's schema panicked.
+var ErrTenantPanic = errors.New("tenant migration panicked")
+
+// TenantResult reports the outcome of migrating a single tenant schema.
+type TenantResult struct {
+	// Schema is the tenant's schema.
+	Schema string
+
+	// Err is nil if the tenant's schema was migrated successfully.
+	Err error
+
+	// Duration is how long it took to migrate the tenant's schema.
+	Duration time.Duration
+}
+
+// TenantReport lists the results of migrating each tenant schema, in the order the
+// schemas were listed.
+type TenantReport []TenantResult
+
+// Failed returns the results of the tenant schemas that failed to migrate.
+func (report TenantReport) Failed() TenantReport {
+	var failed TenantReport
+	for _, result := range report {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// Err joins the errors from the tenant schemas that failed to migrate, each prefixed with
+// the schema.  Returns nil if every tenant schema was migrated.
+func (report TenantReport) Err() error {
+	var errs []error
+	for _, result := range report.Failed() {
+		errs = append(errs, fmt.Errorf("tenant %s: %w", result.Schema, result.Err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ApplyTenants applies the migrations to each of the tenant schemas listed in Tenants or
+// returned by TenantQuery, in PostgreSQL databases that isolate each tenant in its own
+// schema.  Each tenant is migrated as if by Apply, with the schema first in the search
+// path, followed by any schemas in the SearchPath option, and with its own metadata table
+// in the schema, e.g. `tenant_1.schema_migrations`.  Schemas that don't exist are
+// created.
+//
+// Up to TenantConcurrency tenants are migrated at the same time, so `span` must be a
+// connection pool, not a transaction, and any Hook must be safe to call concurrently.  A
+// failure migrating one tenant doesn't stop the others, nor does a panic, which is
+// reported as the tenant's error wrapping ErrTenantPanic.  Returns a report on every
+// tenant, along with the joined errors of those that failed; see TenantReport.Err.
+func (options Options) ApplyTenants(ctx context.Context, span Span) (TenantReport, error) {
+	schemas, err := options.tenants(ctx, span)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := options.TenantConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	report := make(TenantReport, len(schemas))
+	running := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, schema := range schemas {
+		report[i].Schema = schema
+
+		select {
+		case running <- struct{}{}:
+		case <-ctx.Done():
+			report[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(result *TenantResult) {
+			defer wg.Done()
+			defer func() {
+				<-running
+			}()
+
+			options.applyTenant(ctx, span, result)
+		}(&report[i])
+	}
+
+	wg.Wait()
+
+	return report, report.Err()
+}
+
+// Migrates the tenant's schema, recording the outcome in the result.  Recovers from a
+// panic, so it doesn't crash the process while migrating the other tenants.
+func (options Options) applyTenant(ctx context.Context, span Span, result *TenantResult) {
+	start := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("%w: %v", ErrTenantPanic, r)
+		}
+
+		result.Duration = time.Since(start)
+	}()
+
+	result.Err = options.tenant(result.Schema).Apply(ctx, span)
+}
+
+// Returns the Tenants, followed by the schemas returned by the TenantQuery, without
+// duplicates.
+func (options Options) tenants(ctx context.Context, span Span) ([]string, error) {
+	schemas := slices.Clone(options.Tenants)
+
+	if options.TenantQuery != "" {
+		rows, err := span.QueryMigration(ctx, options.TenantQuery)
+		if err != nil {
+			return nil, fmt.Errorf("unable to query the tenant schemas: %w", err)
+		}
+		defer func() {
+			_ = rows.Close()
+		}()
+
+		for rows.Next() {
+			var schema string
+			if err := rows.Scan(&schema); err != nil {
+				return nil, err
+			}
+
+			schemas = append(schemas, schema)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var unique []string
+	found := make(map[string]bool, len(schemas))
+
+	for _, schema := range schemas {
+		if !found[schema] {
+			found[schema] = true
+			unique = append(unique, schema)
+		}
+	}
+
+	return unique, nil
+}
+
+// Returns the options for migrating the tenant schema:  the metadata table moves into the
+// schema, the schema goes first in the search path, and log messages include the schema.
+// A legacy metadata table isn't adopted, as it can't belong to every tenant.
+func (options Options) tenant(schema string) Options {
+	options.MetadataTable.Schema = schema
+	options.SearchPath = slices.Concat([]string{schema}, options.SearchPath)
+	options.LegacyTables = nil
+
+	if options.Logger != nil {
+		options.Logger = options.Logger.With(AttrSchema, schema)
+	}
+
+	return options
+}
+
+// Quotes each identifier and joins them with commas, e.g. for the search path.
+func quoteIdentifiers(identifiers []string) string {
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+	}
+
+	return strings.Join(quoted, ", ")
+}
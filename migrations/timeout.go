@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrTimeoutsUnsupported returned if a migration sets a `lock_timeout` or
+// `statement_timeout`, but the database span doesn't implement TimeoutSetter.
+var ErrTimeoutsUnsupported = errors.New("lock and statement timeouts are not supported by the database span")
+
+// TimeoutSetter is implemented by a Span that can limit how long the rest of its
+// transaction waits for locks and runs each statement, e.g. with PostgreSQL's
+// `SET LOCAL lock_timeout`.  A timeout of zero isn't set.
+type TimeoutSetter interface {
+	SetTimeouts(ctx context.Context, lockTimeout, statementTimeout time.Duration) error
+}
+
+// PostgreSQL's SQLSTATE when a lock couldn't be acquired before the lock_timeout expired.
+const lockNotAvailableState = "55P03"
+
+// The delay before the first retry of a migration that timed out waiting for a lock.
+// Each retry waits twice as long as the last, up to maxRetryDelay.
+const (
+	baseRetryDelay = 500 * time.Millisecond
+	maxRetryDelay  = 30 * time.Second
+)
+
+// Returns true if the error is the database reporting a lock wasn't available before the
+// lock timeout expired.  Database errors that report a SQLSTATE, such as the
+// pgconn.PgError, are checked for PostgreSQL's lock_not_available code.
+func lockNotAvailable(err error) bool {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState() == lockNotAvailableState
+	}
+
+	return false
+}
+
+// Returns how long to wait before retrying a migration, after the failed attempt,
+// starting at zero.
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// Returns the statements to set the lock and statement timeouts in a transaction, if
+// they're set.
+func timeoutStatements(lockTimeout, statementTimeout time.Duration) []string {
+	var statements []string
+
+	if lockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set local lock_timeout = '%dms'", lockTimeout.Milliseconds()))
+	}
+
+	if statementTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set local statement_timeout = '%dms'", statementTimeout.Milliseconds()))
+	}
+
+	return statements
+}
+
+// Sets the lock and statement timeouts in the transaction, if they're set.  Returns
+// ErrTimeoutsUnsupported if they're set and the transaction doesn't implement
+// TimeoutSetter.
+func setTimeouts(ctx context.Context, tx Span, lockTimeout, statementTimeout time.Duration) error {
+	if lockTimeout <= 0 && statementTimeout <= 0 {
+		return nil
+	}
+
+	setter, ok := tx.(TimeoutSetter)
+	if !ok {
+		return ErrTimeoutsUnsupported
+	}
+
+	return setter.SetTimeouts(ctx, lockTimeout, statementTimeout)
+}
+
+// Returns the logger for warnings:  the migration's logger, or a logger that discards
+// them if there isn't one.
+func (m Migration) warnings() *slog.Logger {
+	if m.logger != nil {
+		return m.logger
+	}
+
+	return discard
+}
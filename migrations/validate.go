@@ -0,0 +1,183 @@
+package migrations
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Revisions at or above this are considered timestamps, e.g. `20261016120000`, and
+// aren't checked for gaps.
+const minTimestampRevision = 19000101000000
+
+var (
+	// ErrInvalidFilename returned by Validate if a migration filename doesn't start
+	// with a revision number.
+	ErrInvalidFilename = errors.New("invalid migration filename")
+
+	// ErrDuplicateRevision returned by Validate if more than one migration has the same
+	// revision.
+	ErrDuplicateRevision = errors.New("duplicate revision")
+
+	// ErrMissingUp returned by Validate if a migration file has no `--- !Up` section.
+	ErrMissingUp = errors.New("no up section")
+
+	// ErrEmptyDown returned by Validate if a migration file's "down" section is missing
+	// or empty, and the migration isn't marked irreversible with /stop.
+	ErrEmptyDown = errors.New("empty down section")
+
+	// ErrRevisionGap returned by Validate if sequential revisions skip a number.
+	ErrRevisionGap = errors.New("gap in revisions")
+)
+
+// Validate checks the migration files available to the options' Reader and the Go
+// migrations, without connecting to a database, so problems may be caught in CI before
+// they reach a database.  It reports:
+//
+// * migration filenames without a valid revision (ErrInvalidFilename)
+// * migrations sharing the same revision (ErrDuplicateRevision)
+// * migration files, including repeatable migrations, without an "up" section
+// (ErrMissingUp)
+// * migration files with an empty "down" section that aren't marked /stop (ErrEmptyDown)
+// * section modifiers with invalid values, e.g. `lock_timeout=5000` (ErrInvalidModifier)
+// * gaps between sequential revisions (ErrRevisionGap); timestamp revisions are expected
+// to have gaps and aren't checked
+//
+// All the problems are returned, joined with errors.Join.  Use errors.Is to check for a
+// particular problem.  With Sources, validates each source, prefixing its problems with
+// the source name.
+func (options Options) Validate() error {
+	if len(options.Sources) > 0 {
+		return options.validateSources()
+	}
+
+	available, err := options.available(Up)
+	if err != nil {
+		return err
+	}
+
+	registered := options.goMigrations()
+
+	var problems []error
+	byRevision := make(map[int][]string)
+
+	for _, migration := range available {
+		rev, err := Revision(migration)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", migration, ErrInvalidFilename))
+			continue
+		}
+
+		byRevision[rev] = append(byRevision[rev], migration)
+
+		if _, ok := registered[migration]; ok {
+			continue
+		}
+
+		if err := options.validateFile(Join(options.Directory, migration)); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	revisions := make([]int, 0, len(byRevision))
+	for rev := range byRevision {
+		revisions = append(revisions, rev)
+	}
+
+	sort.Ints(revisions)
+
+	for i, rev := range revisions {
+		if migrations := byRevision[rev]; len(migrations) > 1 {
+			sort.Strings(migrations)
+			problems = append(problems, fmt.Errorf("%s: %w %d", strings.Join(migrations, ", "), ErrDuplicateRevision, rev))
+		}
+
+		if i == 0 || rev >= minTimestampRevision {
+			continue
+		}
+
+		if prev := revisions[i-1]; rev > prev+1 {
+			problems = append(problems, fmt.Errorf("%s: %w, no revision %d", byRevision[rev][0], ErrRevisionGap, prev+1))
+		}
+	}
+
+	repeatables, err := Repeatables(options.Reader, options.Directory)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range repeatables {
+		_, err := ReadSQL(options.Reader, Join(options.Directory, migration), Up)
+		if errors.Is(err, ErrUpDownBlocksNotFound) {
+			problems = append(problems, fmt.Errorf("%s: %w", migration, ErrMissingUp))
+		} else if err != nil {
+			problems = append(problems, err)
+		} else if _, err := ReadSection(options.Reader, Join(options.Directory, migration), Up, options.Env); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// Checks the migration file has an "up" section and a "down" section with SQL, unless the
+// migration is irreversible, and that the sections' modifiers are valid.
+func (options Options) validateFile(path string) error {
+	f, err := options.Reader.Read(path)
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			_ = closer.Close()
+		}()
+	}
+
+	var hasUp bool
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if found := dirRe.FindStringSubmatch(s.Text()); len(found) > 1 && Direction(strings.ToLower(found[1])) == Up {
+			hasUp = true
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	filename := Filename(path)
+
+	if !hasUp {
+		return fmt.Errorf("%s: %w", filename, ErrMissingUp)
+	}
+
+	if _, err := ReadSection(options.Reader, path, Up, options.Env); err != nil {
+		return err
+	}
+
+	section, err := ReadSection(options.Reader, path, Down, options.Env)
+	if err != nil {
+		return err
+	}
+
+	if section.Stop {
+		return nil
+	}
+
+	// ReadSQL reports a missing or empty section as ErrUpDownBlocksNotFound
+	downSQL, err := ReadSQL(options.Reader, path, Down)
+	if err != nil && !errors.Is(err, ErrUpDownBlocksNotFound) {
+		return err
+	}
+
+	if strings.TrimSpace(downSQL) == "" {
+		return fmt.Errorf("%s: %w", filename, ErrEmptyDown)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+module github.com/sbowman/drawbridge/mysql
+
+go 1.24.0
+
+require (
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/sbowman/drawbridge v0.9.9
+)
+
+require filippo.io/edwards25519 v1.1.0 // indirect
+
+replace github.com/sbowman/drawbridge => ../
@@ -0,0 +1,542 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sbowman/drawbridge"
+	"github.com/sbowman/drawbridge/migrations"
+)
+
+// MetadataVersion is the current format version of the metadata table.
+//
+// * Version 1: migration, rollback
+// * Version 2: checksum
+// * Version 3: applied_at, duration_ms, applied_by
+// * Version 4: dirty
+// * Version 5: irreversible
+// * Version 6: squashed_by
+// * Version 7: repeatable
+// * Version 8: env
+const MetadataVersion = 8
+
+// The statements to upgrade the metadata table to each version, from the version before
+// it.  Each statement is formatted with the metadata table name.  MySQL support was added
+// at version 8, so these only upgrade a table created by hand, e.g. by an application
+// migrating to drawbridge.
+var metadataUpgrades = map[int][]string{
+	2: {
+		"alter table %s add column checksum varchar(64)",
+	},
+	3: {
+		"alter table %s add column applied_at datetime null",
+		"alter table %s add column duration_ms bigint",
+		"alter table %s add column applied_by varchar(255)",
+	},
+	4: {
+		"alter table %s add column dirty boolean not null default false",
+	},
+	5: {
+		"alter table %s add column irreversible boolean not null default false",
+	},
+	6: {
+		"alter table %s add column squashed_by varchar(768)",
+	},
+	7: {
+		"alter table %s add column repeatable boolean not null default false",
+	},
+	8: {
+		"alter table %s add column env varchar(255)",
+	},
+}
+
+// The maximum length of a GET_LOCK lock name.
+const maxLockName = 64
+
+var (
+	// ErrInvalidTableName returned if the table name isn't in a valid format
+	// (letters, numbers, underscores).
+	ErrInvalidTableName = errors.New("metadata table name contains invalid characters")
+
+	// ErrTableNameRequired returned if the table name is blank.
+	ErrTableNameRequired = errors.New("metadata table name is required")
+)
+
+// CreateMetadata creates the table in the database used to track the state of the
+// database migrations.  If the table was created by an older version of the migrations
+// package, upgrades it.  The metadata table is created in the connection's database, so
+// the schema is ignored.
+func (db *DB) CreateMetadata(ctx context.Context, _, table string) (string, error) {
+	return createMetadata(ctx, db, table)
+}
+
+// CreateMetadata creates the table in the database used to track the state of the
+// database migrations.  If the table was created by an older version of the migrations
+// package, upgrades it.  The metadata table is created in the connection's database, so
+// the schema is ignored.
+//
+// Note that MySQL implicitly commits the transaction when creating the table.
+func (tx *Tx) CreateMetadata(ctx context.Context, _, table string) (string, error) {
+	return createMetadata(ctx, tx, table)
+}
+
+// LockMetadata panics because it makes no sense to lock the table out of a transaction.
+func (db *DB) LockMetadata(_ context.Context, _ string) error {
+	panic("You may not lock a table outside a transaction")
+}
+
+// UnlockMetadata does nothing.
+func (db *DB) UnlockMetadata(_ context.Context, _ string) {
+	// Do nothing...
+}
+
+// LockMetadata acquires a named lock with GET_LOCK to prevent other processes from
+// applying migrations simultaneously, waiting for as long as it takes.  Rather than lock
+// the metadata table itself, which would end the transaction with an implicit commit,
+// the lock is named for the metadata table.
+func (tx *Tx) LockMetadata(ctx context.Context, metadataTable string) error {
+	return tx.LockMetadataWait(ctx, metadataTable, 0)
+}
+
+// LockMetadataWait acquires the named lock for the metadata table like LockMetadata,
+// waiting up to `wait` for another process to release it, or indefinitely if `wait` is
+// zero.  The migrations package calls this with the options' LockWait (`DB_LOCK_WAIT`).
+// If the wait expires, returns a [migrations.LockTimeoutError] identifying the
+// connection holding the lock.
+func (tx *Tx) LockMetadataWait(ctx context.Context, metadataTable string, wait time.Duration) error {
+	name := lockName(metadataTable)
+
+	err := migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked *int
+		err := tx.QueryRow(ctx, "select get_lock(?, 0)", name).Scan(&locked)
+		return locked != nil && *locked == 1, err
+	})
+	if err != nil {
+		return lockTimeout(ctx, tx.Tx, name, wait, err)
+	}
+
+	tx.locks = append(tx.locks, name)
+	return nil
+}
+
+// UnlockMetadata does nothing.  The lock is released at the end of the transaction.
+func (tx *Tx) UnlockMetadata(_ context.Context, _ string) {
+	// Do nothing...
+}
+
+// AdvisoryLock holds a GET_LOCK lock on a dedicated connection for the entire
+// migrations run, waiting up to `wait` for another process to release it.  If the wait
+// expires, returns a [migrations.LockTimeoutError] identifying the connection holding
+// the lock.
+func (db *DB) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := lockName(metadataTable)
+
+	err = migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked *int
+		err := conn.QueryRowContext(ctx, "select get_lock(?, 0)", name).Scan(&locked)
+		return locked != nil && *locked == 1, err
+	})
+	if err != nil {
+		err = lockTimeout(ctx, conn, name, wait, err)
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		var released *int
+		err := conn.QueryRowContext(context.WithoutCancel(ctx), "select release_lock(?)", name).Scan(&released)
+		if err != nil {
+			// Discard the connection rather than return it to the pool still locked
+			_ = conn.Raw(func(any) error {
+				return sqldriver.ErrBadConn
+			})
+		}
+
+		_ = conn.Close()
+		return err
+	}, nil
+}
+
+// AdvisoryLock holds a GET_LOCK lock until the transaction completes, waiting up to
+// `wait` for another process to release it.  If the wait expires, returns a
+// [migrations.LockTimeoutError] identifying the connection holding the lock.
+func (tx *Tx) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	name := lockName(metadataTable)
+
+	err := migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked *int
+		err := tx.QueryRow(ctx, "select get_lock(?, 0)", name).Scan(&locked)
+		return locked != nil && *locked == 1, err
+	})
+	if err != nil {
+		return nil, lockTimeout(ctx, tx.Tx, name, wait, err)
+	}
+
+	tx.locks = append(tx.locks, name)
+
+	// Released at the end of the transaction
+	return func(context.Context) error {
+		return nil
+	}, nil
+}
+
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.  The
+// schema is the table's database; without one, the connection's database.
+func (db *DB) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return metadataColumns(ctx, db, schema, table)
+}
+
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.  The
+// schema is the table's database; without one, the connection's database.
+func (tx *Tx) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return metadataColumns(ctx, tx, schema, table)
+}
+
+// BackslashEscapes returns true, as MySQL escapes quotes in string literals with a
+// backslash unless the NO_BACKSLASH_ESCAPES SQL mode is set.  The migrations package
+// uses this to split migrations into statements.
+func (db *DB) BackslashEscapes() bool {
+	return true
+}
+
+// BackslashEscapes returns true, as MySQL escapes quotes in string literals with a
+// backslash unless the NO_BACKSLASH_ESCAPES SQL mode is set.  The migrations package
+// uses this to split migrations into statements.
+func (tx *Tx) BackslashEscapes() bool {
+	return true
+}
+
+// BeginMigration starts a transaction for the migrations package.
+func (db *DB) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	tx, err := db.newTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// CommitMigration does nothing on a connection, since you're not in a transaction.
+func (db *DB) CommitMigration(_ context.Context) error {
+	return nil
+}
+
+// CloseMigration does nothing on a connection.
+func (db *DB) CloseMigration(_ context.Context) error {
+	return nil
+}
+
+// ExecMigration executes the migration SQL without returning any rows.  The
+// migrations package's `$1` placeholders are rewritten for MySQL.
+func (db *DB) ExecMigration(ctx context.Context, query string, args ...any) error {
+	query, args = migrations.Rebind(query, args)
+
+	_, err := db.Exec(ctx, query, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (db *DB) QueryMigration(ctx context.Context, query string, args ...any) (migrations.Rows, error) {
+	query, args = migrations.Rebind(query, args)
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (db *DB) QueryRowMigration(ctx context.Context, query string, args ...any) migrations.Row {
+	query, args = migrations.Rebind(query, args)
+	return db.QueryRow(ctx, query, args...)
+}
+
+// BeginMigration starts a nested transaction for the migrations package.
+func (tx *Tx) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	if _, err := tx.Begin(ctx); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// CommitMigration commits the transaction, or releases the nested transaction's
+// savepoint.
+func (tx *Tx) CommitMigration(_ context.Context) error {
+	return tx.Commit()
+}
+
+// CloseMigration rolls back the transaction or nested transaction, if it hasn't been
+// committed.
+func (tx *Tx) CloseMigration(ctx context.Context) error {
+	return tx.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.  The
+// migrations package's `$1` placeholders are rewritten for MySQL.
+func (tx *Tx) ExecMigration(ctx context.Context, query string, args ...any) error {
+	query, args = migrations.Rebind(query, args)
+
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (tx *Tx) QueryMigration(ctx context.Context, query string, args ...any) (migrations.Rows, error) {
+	query, args = migrations.Rebind(query, args)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (tx *Tx) QueryRowMigration(ctx context.Context, query string, args ...any) migrations.Row {
+	query, args = migrations.Rebind(query, args)
+	return tx.QueryRow(ctx, query, args...)
+}
+
+// Returns the GET_LOCK name for the metadata table.  Lock names are limited to 64
+// characters, so long table names use the advisory lock key instead.
+func lockName(metadataTable string) string {
+	name := "drawbridge:" + metadataTable
+	if len(name) <= maxLockName {
+		return name
+	}
+
+	return fmt.Sprintf("drawbridge:%016x", uint64(migrations.AdvisoryLockKey(metadataTable)))
+}
+
+// Queries a single row; implemented by sql.Conn and sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// If the error is a migrations.ErrLockTimeout, returns a LockTimeoutError identifying the
+// connection holding the lock.  Otherwise returns the error.
+func lockTimeout(ctx context.Context, q rowQuerier, name string, wait time.Duration, err error) error {
+	if !errors.Is(err, migrations.ErrLockTimeout) {
+		return err
+	}
+
+	lockErr := &migrations.LockTimeoutError{Wait: wait}
+
+	row := q.QueryRowContext(ctx, "select coalesce(is_used_lock(?), 0)", name)
+	_ = row.Scan(&lockErr.PID)
+
+	return lockErr
+}
+
+var validObjName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Validates the table name and returns the table name.
+func isValidTableName(table string) error {
+	if table == "" {
+		return ErrTableNameRequired
+	}
+
+	if !validObjName.MatchString(table) {
+		return ErrInvalidTableName
+	}
+
+	return nil
+}
+
+// Creates the metadata table if it's missing, or upgrades the table if it was created by
+// an older version of the migrations package.
+func createMetadata(ctx context.Context, span drawbridge.Span, table string) (string, error) {
+	if err := isValidTableName(table); err != nil {
+		return "", err
+	}
+
+	tx, err := span.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer TxClose(ctx, tx)
+
+	missing, err := missingMetadataTable(ctx, tx, table)
+	if err != nil {
+		return "", err
+	}
+
+	if missing {
+		if _, err := tx.Exec(ctx, createTableStmt(table)); err != nil {
+			return "", err
+		}
+
+		if _, err := tx.Exec(ctx, createVersionStmt(table)); err != nil {
+			return "", err
+		}
+
+		if _, err := tx.Exec(ctx, "insert into "+table+"_version (version) values (?)", MetadataVersion); err != nil {
+			return "", err
+		}
+	} else if err := upgradeMetadata(ctx, tx, table); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return table, nil
+}
+
+// Upgrades the metadata table in place to the latest MetadataVersion.  MySQL commits
+// each `alter table` implicitly, so an interrupted upgrade is resumed from the columns
+// already added.
+func upgradeMetadata(ctx context.Context, span drawbridge.Span, table string) error {
+	version, err := metadataVersion(ctx, span, table)
+	if err != nil {
+		return err
+	}
+
+	if version >= MetadataVersion {
+		return nil
+	}
+
+	for v := version + 1; v <= MetadataVersion; v++ {
+		for _, stmt := range metadataUpgrades[v] {
+			if _, err := span.Exec(ctx, fmt.Sprintf(stmt, table)); err != nil {
+				return fmt.Errorf("unable to upgrade metadata table %s to version %d: %w", table, v, err)
+			}
+		}
+
+		if _, err := span.Exec(ctx, "update "+table+"_version set version = ?", v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the format version of the metadata table.  Metadata tables created before the
+// format was versioned don't have a version table, so the version is determined by the
+// columns in the table, and the version table is created.
+func metadataVersion(ctx context.Context, span drawbridge.Span, table string) (int, error) {
+	missing, err := missingMetadataTable(ctx, span, table+"_version")
+	if err != nil {
+		return 0, err
+	}
+
+	if !missing {
+		var version int
+
+		row := span.QueryRow(ctx, "select version from "+table+"_version")
+		if err := row.Scan(&version); err != nil {
+			return 0, err
+		}
+
+		return version, nil
+	}
+
+	version := 1
+	if missing, err := missingMetadataColumn(ctx, span, table, "checksum"); err != nil {
+		return 0, err
+	} else if !missing {
+		version = 2
+	}
+
+	if _, err := span.Exec(ctx, createVersionStmt(table)); err != nil {
+		return 0, err
+	}
+
+	if _, err := span.Exec(ctx, "insert into "+table+"_version (version) values (?)", version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Returns true if the table doesn't exist in the connection's database.
+func missingMetadataTable(ctx context.Context, span drawbridge.Span, table string) (bool, error) {
+	var count int
+
+	row := span.QueryRow(ctx, "select count(*) from information_schema.tables where table_schema = database() and table_name = ?", table)
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
+// Returns true if the metadata table is missing the column, i.e. the metadata table was
+// created by an older version of the migrations package.
+func missingMetadataColumn(ctx context.Context, span drawbridge.Span, table, column string) (bool, error) {
+	var count int
+
+	row := span.QueryRow(ctx, "select count(*) from information_schema.columns where table_schema = database() and table_name = ? and column_name = ?", table, column)
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
+// Returns the names of the table's columns in the database, or nil if the table doesn't
+// exist.
+func metadataColumns(ctx context.Context, span drawbridge.Span, schema, table string) ([]string, error) {
+	rows, err := span.Query(ctx, "select column_name from information_schema.columns "+
+		"where table_schema = coalesce(nullif(?, ''), database()) and table_name = ? order by ordinal_position", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// Returns the create table statement for the metadata table.  InnoDB limits an index key
+// to 3072 bytes, so the migration name is limited to 768 four-byte characters.
+func createTableStmt(metadataTable string) string {
+	return fmt.Sprintf("create table if not exists %s("+
+		"migration varchar(768) not null primary key, "+
+		"rollback text, "+
+		"checksum varchar(64), "+
+		"applied_at datetime null default current_timestamp, "+
+		"duration_ms bigint, "+
+		"applied_by varchar(255), "+
+		"dirty boolean not null default false, "+
+		"irreversible boolean not null default false, "+
+		"squashed_by varchar(768), "+
+		"repeatable boolean not null default false, "+
+		"env varchar(255))", metadataTable)
+}
+
+// Returns the create table statement for the table tracking the metadata table's format
+// version.
+func createVersionStmt(metadataTable string) string {
+	return fmt.Sprintf("create table if not exists %s_version(version integer not null)", metadataTable)
+}
@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/sbowman/drawbridge"
+)
+
+// MySQL's error number for a duplicate entry in a unique index, ER_DUP_ENTRY.
+const errDupEntry = 1062
+
+// Open a MySQL or MariaDB database, e.g. `app:secret@tcp(localhost:3306)/app`.  Uses the
+// Go `database/sql` pooling.
+//
+// Enables `parseTime`, so dates and times scan into a time.Time, and `multiStatements`,
+// so a migration may contain more than one statement.
+func Open(dsn string) (*DB, error) {
+	cfg, err := driver.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ParseTime = true
+	cfg.MultiStatements = true
+
+	connector, err := driver.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{sql.OpenDB(connector)}, nil
+}
+
+// UniqueViolation returns true if the error is a MySQLError with a number of 1062,
+// duplicate entry.  In other words, did a query return an error because a value already
+// exists?
+func UniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var dberr *driver.MySQLError
+	if errors.As(err, &dberr) {
+		return dberr.Number == errDupEntry
+	}
+
+	return false
+}
+
+// NotFound returns true if the error contains a sql.ErrNoRows indicating no results were
+// found for the database query.
+func NotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// TxClose is a shorthand function to use in a defer statement.  If the transaction fails
+// to close (commit or rollback), the function panics.
+func TxClose(ctx context.Context, tx drawbridge.Span) {
+	err := tx.Close(ctx)
+	if err == nil {
+		return
+	}
+
+	panic("Transaction failed to close: " + err.Error())
+}
@@ -0,0 +1,326 @@
+package mysqltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gms "github.com/dolthub/go-mysql-server/sql"
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDB is the name of the database in the in-process MySQL server.
+const TestDB = "drawbridge_test"
+
+// The connection to the in-process MySQL server used by the tests.
+var db *mysql.DB
+
+var testFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) primary key);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(255);
+create unique index idx_sample_email on samples (email);
+
+--- !Down
+alter table samples drop column email;
+`)},
+}
+
+func TestMain(m *testing.M) {
+	addr, err := freeAddr()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to find a port for the MySQL server: %s\n", err)
+		os.Exit(1)
+	}
+
+	provider := memory.NewDBProvider(memory.NewDatabase(TestDB))
+	engine := sqle.NewDefault(provider)
+
+	config := server.Config{Protocol: "tcp", Address: addr}
+	s, err := server.NewServer(config, engine, gms.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to create the MySQL server: %s\n", err)
+		os.Exit(1)
+	}
+
+	go func() {
+		_ = s.Start()
+	}()
+
+	db, err = mysql.Open(fmt.Sprintf("root@tcp(%s)/%s", addr, TestDB))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to connect to the %s database: %s\n", TestDB, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	_ = db.Shutdown()
+	_ = s.Close()
+
+	os.Exit(code)
+}
+
+// Do the migrations apply and roll back, with the metadata queries rebound for MySQL?
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(testFS)).WithDirectory("sql")
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "schema_migrations")
+	assert.Nil(err)
+	assert.Equal([]string{"1-create-sample.sql", "2-add-email.sql"}, applied)
+
+	assert.Nil(options.AtLatest(ctx, db))
+
+	_, err = db.Exec(ctx, "insert into samples (name, email) values ('abc', 'abc@nowhere.com')")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into samples (name, email) values ('def', 'abc@nowhere.com')")
+	assert.True(mysql.UniqueViolation(err))
+
+	var email string
+	err = db.QueryRow(ctx, "select email from samples where name = 'def'").Scan(&email)
+	assert.True(mysql.NotFound(err))
+
+	err = options.WithRevision(0).Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err = migrations.Applied(ctx, db, "schema_migrations")
+	assert.Nil(err)
+	assert.Empty(applied)
+	assert.False(tableExists(t, ctx, "samples"))
+}
+
+// Are strings with backslash-escaped quotes kept intact when the migration is run
+// statement by statement?
+func TestSplitBackslashEscapes(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	escapedFS := fstest.MapFS{
+		"sql/1-create-sample.sql": testFS["sql/1-create-sample.sql"],
+		"sql/2-add-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+insert into samples (name) values ('it\'s; fine');
+insert into samples (name) values ('second');
+
+--- !Down
+delete from samples;
+`)},
+	}
+
+	err := migrations.WithReader(migrations.FromFS(escapedFS)).
+		WithDirectory("sql").
+		WithSplitStatements(true).
+		Apply(ctx, db)
+	require.Nil(t, err)
+
+	var count int
+	err = db.QueryRow(ctx, "select count(*) from samples where name = 'it''s; fine'").Scan(&count)
+	assert.Nil(err)
+	assert.Equal(1, count)
+}
+
+// Are nested transactions rolled back to their savepoints, without rolling back the
+// transaction?
+func TestSavepoints(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	_, err := db.Exec(ctx, "create table samples (name varchar(64) primary key)")
+	require.Nil(t, err)
+
+	tx, err := db.Begin(ctx)
+	require.Nil(t, err)
+	defer mysql.TxClose(ctx, tx)
+
+	_, err = tx.Exec(ctx, "insert into samples (name) values ('abc')")
+	require.Nil(t, err)
+
+	nested, err := tx.Begin(ctx)
+	if err != nil && strings.Contains(err.Error(), "savepoints are not supported") {
+		t.Skip("The in-process MySQL server's in-memory databases don't support savepoints")
+	}
+	require.Nil(t, err)
+
+	_, err = nested.Exec(ctx, "insert into samples (name) values ('def')")
+	require.Nil(t, err)
+	assert.Nil(nested.Close(ctx))
+
+	nested, err = tx.Begin(ctx)
+	require.Nil(t, err)
+
+	_, err = nested.Exec(ctx, "insert into samples (name) values ('ghi')")
+	require.Nil(t, err)
+	assert.Nil(nested.Commit())
+	assert.Nil(nested.Close(ctx))
+
+	assert.Nil(tx.Commit())
+
+	var names []string
+
+	rows, err := db.Query(ctx, "select name from samples order by name")
+	require.Nil(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var name string
+		assert.Nil(rows.Scan(&name))
+		names = append(names, name)
+	}
+
+	assert.Nil(rows.Err())
+	assert.Equal([]string{"abc", "ghi"}, names)
+}
+
+// Does the GET_LOCK lock on the metadata table block an advisory lock until the
+// transaction completes?
+func TestLockMetadata(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	tx, err := db.BeginMigration(ctx)
+	require.Nil(t, err)
+	defer migrations.TxClose(ctx, tx)
+
+	require.Nil(t, tx.LockMetadata(ctx, "schema_migrations"))
+
+	_, err = db.AdvisoryLock(ctx, "schema_migrations", 300*time.Millisecond)
+	assert.True(errors.Is(err, migrations.ErrLockTimeout))
+
+	var lockErr *migrations.LockTimeoutError
+	if assert.ErrorAs(err, &lockErr) {
+		assert.NotZero(lockErr.PID)
+	}
+
+	require.Nil(t, tx.CommitMigration(ctx))
+
+	unlock, err := db.AdvisoryLock(ctx, "schema_migrations", 300*time.Millisecond)
+	require.Nil(t, err)
+	assert.Nil(unlock(ctx))
+}
+
+// Does Apply give up waiting for the GET_LOCK lock on the metadata table after the lock
+// wait?
+func TestLockMetadataWait(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+
+	unlock, err := db.AdvisoryLock(ctx, "schema_migrations", 0)
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromFS(testFS)).
+		WithDirectory("sql").
+		WithLockWait(300 * time.Millisecond)
+
+	err = options.Apply(ctx, db)
+	assert.True(errors.Is(err, migrations.ErrLockTimeout))
+
+	require.Nil(t, unlock(ctx))
+
+	err = options.Apply(ctx, db)
+	assert.Nil(err)
+}
+
+// Returns true if the table exists in the test database.
+func tableExists(t *testing.T, ctx context.Context, table string) bool {
+	var count int
+
+	row := db.QueryRow(ctx, "select count(*) from information_schema.tables where table_schema = database() and table_name = ?", table)
+	if err := row.Scan(&count); err != nil {
+		t.Fatalf("Unable to look up table %s: %s", table, err)
+	}
+
+	return count > 0
+}
+
+// Drops the tables created by the tests.
+func clean(t *testing.T, ctx context.Context) {
+	for _, table := range []string{"samples", "schema_migrations", "schema_migrations_version"} {
+		if _, err := db.Exec(ctx, "drop table if exists "+table); err != nil {
+			t.Fatalf("Unable to drop table %s: %s", table, err)
+		}
+	}
+}
+
+// Returns a local address with a free port for the MySQL server.
+func freeAddr() (string, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+// Is a legacy metadata table in the database adopted, rather than the migrations applied
+// again?
+func TestAdoptLegacy(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer clean(t, ctx)
+	defer func() {
+		if _, err := db.Exec(ctx, "drop table if exists applied"); err != nil {
+			t.Fatalf("Unable to drop table applied: %s", err)
+		}
+	}()
+
+	_, err := db.Exec(ctx, "create table applied (migration varchar(255) not null primary key, rollback text)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into applied (migration, rollback) values ('1-create-sample.sql', 'drop table samples')")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) primary key)")
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromFS(testFS)).
+		WithDirectory("sql").
+		WithLegacyTables("public.schema_migrations", TestDB+".applied")
+
+	report, err := options.AdoptLegacy(ctx, db)
+	require.Nil(t, err)
+	assert.Equal(migrations.LegacyReport{Table: TestDB + ".applied", Migrations: 1, Rollbacks: 1}, report)
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "schema_migrations")
+	assert.Nil(err)
+	assert.Equal([]string{"1-create-sample.sql", "2-add-email.sql"}, applied)
+}
@@ -0,0 +1,4 @@
+// Package mysqltest is its own Go submodule so that you don't accidentally pull in a
+// dependency to go-mysql-server, the in-process MySQL server the tests run against, if
+// you're using the mysql package.
+package mysqltest
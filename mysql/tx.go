@@ -0,0 +1,214 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/sbowman/drawbridge"
+)
+
+// MySQL's error number for a savepoint that doesn't exist, ER_SP_DOES_NOT_EXIST.
+const errSavepointMissing = 1305
+
+// Tracks subtransaction commits and rollbacks
+type txState uint8
+
+const (
+	txPending txState = iota
+	txCommit
+)
+
+// Tx wraps the *sql.Tx to support nested transactions with savepoints.  Each Tx holds a
+// dedicated connection from the pool, so the session-level locks acquired in the
+// transaction, i.e. by LockMetadata, may be released when the transaction completes.
+type Tx struct {
+	*sql.Tx
+
+	conn       *sql.Conn
+	depth      []txState
+	inRollback bool
+
+	// The GET_LOCK locks held by the session, released at the end of the transaction
+	locks []string
+}
+
+// Create a new Span-compatible transaction that supports sub-transactions.
+func (db *DB) newTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &Tx{
+		Tx:    tx,
+		conn:  conn,
+		depth: []txState{txPending},
+	}, nil
+}
+
+// Begin starts a nested transaction with a savepoint.
+func (tx *Tx) Begin(ctx context.Context) (drawbridge.Span, error) {
+	return tx.BeginTx(ctx, nil)
+}
+
+// BeginTx starts a nested transaction with a savepoint.  MySQL doesn't support options on
+// a savepoint, so the options are ignored.
+func (tx *Tx) BeginTx(ctx context.Context, _ *sql.TxOptions) (drawbridge.Span, error) {
+	if tx.inRollback {
+		return nil, drawbridge.ErrRolledBack
+	}
+
+	tx.depth = append(tx.depth, txPending)
+
+	if _, err := tx.Tx.ExecContext(ctx, "savepoint "+tx.savepoint()); err != nil {
+		tx.pop()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Exec executes a query without returning any rows.  The args are for any
+// placeholder parameters in the query.
+func (tx *Tx) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// Query executes a query that returns rows, typically a SELECT.  The args are for
+// any placeholder parameters in the query.
+func (tx *Tx) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.QueryContext(ctx, query, args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row. QueryRow
+// always returns a non-nil value. Errors are deferred until [sql.Row]'s Scan
+// method is called.  If the query selects no rows, the [*sql.Row.Scan] will
+// return [sql.ErrNoRows].  Otherwise, [*sql.Row.Scan] scans the first selected
+// row and discards the rest.
+func (tx *Tx) QueryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.QueryRowContext(ctx, query, args...)
+}
+
+// Commit commits the transaction if this is a real transaction or releases the
+// savepoint if this is a nested transaction.  Returns drawbridge.ErrCommitted if the
+// transaction was already committed, or drawbridge.ErrRolledBack if it was rolled back.
+//
+// MySQL implicitly commits the transaction on most schema changes, such as
+// `create table`, which also releases its savepoints.  Releasing a savepoint lost to an
+// implicit commit does nothing.
+func (tx *Tx) Commit() error {
+	if tx.inRollback {
+		return drawbridge.ErrRolledBack
+	}
+
+	if tx.current() == txCommit {
+		return drawbridge.ErrCommitted
+	}
+
+	if len(tx.depth) == 1 {
+		tx.state(txCommit)
+		defer tx.release(context.Background())
+
+		return tx.Tx.Commit()
+	}
+
+	if _, err := tx.Tx.Exec("release savepoint " + tx.savepoint()); err != nil && !savepointMissing(err) {
+		return err
+	}
+
+	tx.state(txCommit)
+	return nil
+}
+
+// Close rolls back the transaction if this is a real transaction or rolls back to the
+// savepoint if this is a nested transaction.  Does nothing if the transaction was
+// committed, so it's safe to defer Close even if Commit will be called first in a
+// non-error condition.
+//
+// Rolling back to a savepoint lost to an implicit commit does nothing; MySQL can't roll
+// back the schema changes that caused it.
+func (tx *Tx) Close(ctx context.Context) error {
+	if len(tx.depth) == 0 {
+		return nil
+	}
+	defer tx.pop()
+
+	if tx.current() != txPending {
+		return nil
+	}
+
+	if len(tx.depth) == 1 {
+		tx.inRollback = true
+		defer tx.release(ctx)
+
+		return tx.Tx.Rollback()
+	}
+
+	if _, err := tx.Tx.ExecContext(ctx, "rollback to savepoint "+tx.savepoint()); err != nil && !savepointMissing(err) {
+		return err
+	}
+
+	return nil
+}
+
+// InTx on a transaction always returns true.
+func (tx *Tx) InTx() bool {
+	return true
+}
+
+// Releases the locks held by the transaction's session, and returns the connection to
+// the pool.  If the locks can't be released, the connection is discarded instead.
+func (tx *Tx) release(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, name := range tx.locks {
+		var released sql.NullInt64
+		if err := tx.conn.QueryRowContext(ctx, "select release_lock(?)", name).Scan(&released); err != nil {
+			_ = tx.conn.Raw(func(any) error {
+				return sqldriver.ErrBadConn
+			})
+			break
+		}
+	}
+
+	tx.locks = nil
+	_ = tx.conn.Close()
+}
+
+// Returns the name of the savepoint for the current nested transaction.
+func (tx *Tx) savepoint() string {
+	return fmt.Sprintf("drawbridge_%d", len(tx.depth)-1)
+}
+
+func (tx *Tx) current() txState {
+	return tx.depth[len(tx.depth)-1]
+}
+
+func (tx *Tx) state(value txState) {
+	tx.depth[len(tx.depth)-1] = value
+}
+
+func (tx *Tx) pop() {
+	tx.depth = tx.depth[:len(tx.depth)-1]
+}
+
+// Returns true if the error reports the savepoint doesn't exist, i.e. it was released by
+// an implicit commit.
+func savepointMissing(err error) bool {
+	var dberr *driver.MySQLError
+	if errors.As(err, &dberr) {
+		return dberr.Number == errSavepointMissing
+	}
+
+	return false
+}
@@ -0,0 +1,359 @@
+// Package support holds the PostgreSQL metadata table DDL and upgrades, and other SQL the
+// pgx and database/sql drivers share for the migrations package.  Each driver's
+// migrations_support.go only adapts its own connections and transactions.
+package support
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sbowman/drawbridge/migrations"
+)
+
+// MetadataVersion is the current format version of the metadata table.
+//
+// * Version 1: migration, rollback
+// * Version 2: checksum
+// * Version 3: applied_at, duration_ms, applied_by
+// * Version 4: dirty
+// * Version 5: irreversible
+// * Version 6: squashed_by
+// * Version 7: repeatable
+// * Version 8: env
+const MetadataVersion = 8
+
+// The statements to upgrade the metadata table to each version, from the version before
+// it.  Each statement is formatted with the metadata table name.
+var metadataUpgrades = map[int][]string{
+	2: {
+		"alter table %s add column checksum varchar(64)",
+	},
+	3: {
+		"alter table %s add column applied_at timestamptz",
+		"alter table %s add column duration_ms bigint",
+		"alter table %s add column applied_by varchar(255)",
+	},
+	4: {
+		"alter table %s add column dirty boolean not null default false",
+	},
+	5: {
+		"alter table %s add column irreversible boolean not null default false",
+	},
+	6: {
+		"alter table %s add column squashed_by varchar(1024)",
+	},
+	7: {
+		"alter table %s add column repeatable boolean not null default false",
+	},
+	8: {
+		"alter table %s add column env varchar(255)",
+	},
+}
+
+var (
+	// ErrInvalidSchemaName returned if the schema name isn't in a valid format
+	// (letters, numbers, underscores).
+	ErrInvalidSchemaName = errors.New("metadata schema name contains invalid characters")
+
+	// ErrInvalidTableName returned if the table name isn't in a valid format
+	// (letters, numbers, underscores).
+	ErrInvalidTableName = errors.New("metadata table name contains invalid characters")
+
+	// ErrTableNameRequired returned if the table name is blank.
+	ErrTableNameRequired = errors.New("metadata table name is required")
+)
+
+// LockHolderQuery finds the process holding an advisory lock.  The lock key is split
+// across the classid and objid columns in pg_locks; see LockKeyArgs.
+const LockHolderQuery = "select a.pid, coalesce(a.application_name, ''), coalesce(host(a.client_addr), '') " +
+	"from pg_locks l join pg_stat_activity a on a.pid = l.pid " +
+	"where l.locktype = 'advisory' and l.granted and l.objsubid = 1 " +
+	"and l.classid::bigint = $1 and l.objid::bigint = $2"
+
+// LockKeyArgs splits the advisory lock key into the classid and objid arguments to
+// LockHolderQuery.
+func LockKeyArgs(key int64) (int64, int64) {
+	return int64(uint64(key) >> 32), int64(uint64(key) & 0xffffffff)
+}
+
+// SetTimeouts sets the lock and statement timeouts with `SET LOCAL`, so they only apply
+// to the rest of the transaction.  A timeout of zero isn't set.
+func SetTimeouts(ctx context.Context, tx migrations.Span, lockTimeout, statementTimeout time.Duration) error {
+	if lockTimeout > 0 {
+		if err := tx.ExecMigration(ctx, fmt.Sprintf("set local lock_timeout = '%dms'", lockTimeout.Milliseconds())); err != nil {
+			return err
+		}
+	}
+
+	if statementTimeout > 0 {
+		if err := tx.ExecMigration(ctx, fmt.Sprintf("set local statement_timeout = '%dms'", statementTimeout.Milliseconds())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateMetadata creates the metadata schema and table if they're missing, or upgrades
+// the table if it was created by an older version of the migrations package.  Returns the
+// table name to use for the metadata.
+func CreateMetadata(ctx context.Context, span migrations.Span, schema, table string) (string, error) {
+	if stmt, err := createSchemaStmt(schema); err != nil {
+		return "", err
+	} else if stmt != "" && missingMetadataSchema(ctx, span, schema) {
+		if err := span.ExecMigration(ctx, stmt); err != nil {
+			return "", err
+		}
+	}
+
+	name, err := metadataName(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := span.BeginMigration(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer migrations.TxClose(ctx, tx)
+
+	if missingMetadataTable(ctx, tx, schema, table) {
+		if err := tx.ExecMigration(ctx, createTableStmt(name)); err != nil {
+			return "", err
+		}
+
+		if err := tx.ExecMigration(ctx, createVersionStmt(name)); err != nil {
+			return "", err
+		}
+
+		if err := tx.ExecMigration(ctx, "insert into "+name+"_version (version) values ($1)", MetadataVersion); err != nil {
+			return "", err
+		}
+	} else if err := upgradeMetadata(ctx, tx, schema, table, name); err != nil {
+		return "", err
+	}
+
+	if err := tx.CommitMigration(ctx); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// MetadataColumns returns the names of the table's columns, in order.  If schema is
+// blank, assumes "public."
+func MetadataColumns(ctx context.Context, span migrations.Span, schema, table string) ([]string, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	rows, err := span.QueryMigration(ctx, "select column_name::text from information_schema.columns "+
+		"where table_schema = $1 and table_name = $2 order by ordinal_position", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// Upgrades the metadata table in place to the latest MetadataVersion.  If an upgrade is
+// necessary, locks the metadata table so only one process upgrades it.
+func upgradeMetadata(ctx context.Context, span migrations.Span, schema, table, name string) error {
+	if !missingMetadataTable(ctx, span, schema, table+"_version") {
+		var version int
+
+		row := span.QueryRowMigration(ctx, "select version from "+name+"_version")
+		if err := row.Scan(&version); err != nil {
+			return err
+		}
+
+		if version >= MetadataVersion {
+			return nil
+		}
+	}
+
+	if err := span.ExecMigration(ctx, "lock table "+name+" in access exclusive mode"); err != nil {
+		return err
+	}
+
+	// Another process may have upgraded the table while we waited for the lock
+	version, err := metadataVersion(ctx, span, schema, table, name)
+	if err != nil {
+		return err
+	}
+
+	if version >= MetadataVersion {
+		return nil
+	}
+
+	for v := version + 1; v <= MetadataVersion; v++ {
+		for _, stmt := range metadataUpgrades[v] {
+			if err := span.ExecMigration(ctx, fmt.Sprintf(stmt, name)); err != nil {
+				return fmt.Errorf("unable to upgrade metadata table %s to version %d: %w", name, v, err)
+			}
+		}
+	}
+
+	return span.ExecMigration(ctx, "update "+name+"_version set version = $1", MetadataVersion)
+}
+
+// Returns the format version of the metadata table.  Metadata tables created before the
+// format was versioned don't have a version table, so the version is determined by the
+// columns in the table, and the version table is created.
+func metadataVersion(ctx context.Context, span migrations.Span, schema, table, name string) (int, error) {
+	if !missingMetadataTable(ctx, span, schema, table+"_version") {
+		var version int
+
+		row := span.QueryRowMigration(ctx, "select version from "+name+"_version")
+		if err := row.Scan(&version); err != nil {
+			return 0, err
+		}
+
+		return version, nil
+	}
+
+	version := 1
+	if !missingMetadataColumn(ctx, span, schema, table, "checksum") {
+		version = 2
+	}
+
+	if err := span.ExecMigration(ctx, createVersionStmt(name)); err != nil {
+		return 0, err
+	}
+
+	if err := span.ExecMigration(ctx, "insert into "+name+"_version (version) values ($1)", version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Returns true if the provided schema doesn't exist in the database.  If the schema is
+// blank, returns false.
+func missingMetadataSchema(ctx context.Context, span migrations.Span, schema string) bool {
+	if schema == "" {
+		return false
+	}
+
+	var result bool
+
+	row := span.QueryRowMigration(ctx, "select not(exists(select schema_name from information_schema.schemata where schema_name = $1))", schema)
+	if err := row.Scan(&result); err != nil {
+		panic(fmt.Sprintf("Unable to query for the metadata schema, %s", err))
+	}
+
+	return result
+}
+
+// Returns true if the given table is missing from the database. If table is blank,
+// assumes "public."
+func missingMetadataTable(ctx context.Context, span migrations.Span, schema, table string) bool {
+	if schema == "" {
+		schema = "public"
+	}
+
+	row := span.QueryRowMigration(ctx, "select not(exists(select 1 from pg_catalog.pg_class c "+
+		"join pg_catalog.pg_namespace n "+
+		"on n.oid = c.relnamespace "+
+		"where n.nspname = $1 and c.relname = $2))", schema, table)
+
+	var result bool
+	if err := row.Scan(&result); err != nil {
+		panic(fmt.Sprintf("Unable to query for the metadata table, %s", err))
+	}
+
+	return result
+}
+
+// Returns true if the metadata table is missing the column, i.e. the metadata table was
+// created by an older version of the migrations package.
+func missingMetadataColumn(ctx context.Context, span migrations.Span, schema, table, column string) bool {
+	if schema == "" {
+		schema = "public"
+	}
+
+	row := span.QueryRowMigration(ctx, "select not(exists(select 1 from information_schema.columns "+
+		"where table_schema = $1 and table_name = $2 and column_name = $3))", schema, table, column)
+
+	var result bool
+	if err := row.Scan(&result); err != nil {
+		panic(fmt.Sprintf("Unable to query for the metadata table columns, %s", err))
+	}
+
+	return result
+}
+
+var validObjName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Verify the schema and table names, and returns the combined name.  If schema is blank,
+// returns just the table name.  Otherwise, returns "schema.table."
+func metadataName(schema, table string) (string, error) {
+	if schema != "" && !validObjName.MatchString(schema) {
+		return "", ErrInvalidSchemaName
+	}
+
+	if table == "" {
+		return "", ErrTableNameRequired
+	}
+
+	if !validObjName.MatchString(table) {
+		return "", ErrInvalidTableName
+	}
+
+	if schema == "" {
+		return table, nil
+	}
+
+	return fmt.Sprintf("%s.%s", schema, table), nil
+}
+
+// Validates the schema name and returns the create schema statement, if necessary.  If
+// the schema is blank, returns a blank string and no error, meaning no need to create
+// the schema.
+func createSchemaStmt(schema string) (string, error) {
+	if schema == "" {
+		return "", nil
+	} else if !validObjName.MatchString(schema) {
+		return "", ErrInvalidSchemaName
+	}
+
+	return fmt.Sprintf("create schema if not exists %s", schema), nil
+}
+
+// Returns the create table statement for the metadata table.
+func createTableStmt(metadataTable string) string {
+	return fmt.Sprintf("create table %s("+
+		"migration varchar(1024) not null primary key, "+
+		"rollback text, "+
+		"checksum varchar(64), "+
+		"applied_at timestamptz default current_timestamp, "+
+		"duration_ms bigint, "+
+		"applied_by varchar(255), "+
+		"dirty boolean not null default false, "+
+		"irreversible boolean not null default false, "+
+		"squashed_by varchar(1024), "+
+		"repeatable boolean not null default false, "+
+		"env varchar(255))", metadataTable)
+}
+
+// Returns the create table statement for the table tracking the metadata table's format
+// version.
+func createVersionStmt(metadataTable string) string {
+	return fmt.Sprintf("create table %s_version(version integer not null)", metadataTable)
+}
@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/postgres/internal/support"
+)
+
+// MetadataVersion is the current format version of the metadata table.
+const MetadataVersion = support.MetadataVersion
+
+var (
+	// ErrInvalidSchemaName returned if the schema name isn't in a valid format
+	// (letters, numbers, underscores).
+	ErrInvalidSchemaName = support.ErrInvalidSchemaName
+
+	// ErrInvalidTableName returned if the table name isn't in a valid format
+	// (letters, numbers, underscores).
+	ErrInvalidTableName = support.ErrInvalidTableName
+
+	// ErrTableNameRequired returned if the table name is blank.
+	ErrTableNameRequired = support.ErrTableNameRequired
+)
+
+// CreateMetadata creates the migrations package's metadata table in the requested schema
+// and table if it doesn't already exist.  If the table was created by an older version of
+// the migrations package, upgrades it.  Returns the table name to use for the metadata.
+func (db *DB) CreateMetadata(ctx context.Context, schema, table string) (string, error) {
+	return support.CreateMetadata(ctx, db, schema, table)
+}
+
+// CreateMetadata creates the migrations package's metadata table in the requested schema
+// and table if it doesn't already exist.  If the table was created by an older version of
+// the migrations package, upgrades it.  Returns the table name to use for the metadata.
+func (tx *Tx) CreateMetadata(ctx context.Context, schema, table string) (string, error) {
+	return support.CreateMetadata(ctx, tx, schema, table)
+}
+
+// LockMetadata panics because it makes no sense to lock the table out of a transaction.
+func (db *DB) LockMetadata(_ context.Context, _ string) error {
+	panic("You may not lock a table outside a transaction")
+}
+
+// UnlockMetadata does nothing.
+func (db *DB) UnlockMetadata(_ context.Context, _ string) {
+	// Do nothing...
+}
+
+// LockMetadata locks the metadata table to prevent other processes from applying
+// migrations simultaneously.
+func (tx *Tx) LockMetadata(ctx context.Context, metadataTable string) error {
+	_, err := tx.Exec(ctx, "lock table "+metadataTable+" in access exclusive mode")
+	return err
+}
+
+// UnlockMetadata does nothing.  PostgreSQL unlocks the table at the end of the
+// transaction.
+func (tx *Tx) UnlockMetadata(_ context.Context, _ string) {
+	// Do nothing...
+}
+
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.
+func (db *DB) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return support.MetadataColumns(ctx, db, schema, table)
+}
+
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.
+func (tx *Tx) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return support.MetadataColumns(ctx, tx, schema, table)
+}
+
+// AdvisoryLock holds a PostgreSQL session-level advisory lock on a dedicated connection
+// for the entire migrations run, waiting up to `wait` for another process to release it.
+// If the wait expires, returns a [migrations.LockTimeoutError] identifying the process
+// holding the lock.
+func (db *DB) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := migrations.AdvisoryLockKey(metadataTable)
+
+	err = migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked bool
+		err := conn.QueryRow(ctx, "select pg_try_advisory_lock($1)", key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		err = lockTimeout(ctx, conn, key, wait, err)
+		conn.Release()
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		ctx = context.WithoutCancel(ctx)
+
+		_, err := conn.Exec(ctx, "select pg_advisory_unlock($1)", key)
+		if err != nil {
+			// Discard the connection rather than return it to the pool still locked
+			_ = conn.Conn().Close(ctx)
+		}
+
+		conn.Release()
+		return err
+	}, nil
+}
+
+// SetTimeouts sets the lock and statement timeouts with `SET LOCAL`, so they only apply
+// to the rest of the transaction.  A timeout of zero isn't set.
+func (tx *Tx) SetTimeouts(ctx context.Context, lockTimeout, statementTimeout time.Duration) error {
+	return support.SetTimeouts(ctx, tx, lockTimeout, statementTimeout)
+}
+
+// AdvisoryLock holds a PostgreSQL transaction-level advisory lock until the transaction
+// completes, waiting up to `wait` for another process to release it.  If the wait
+// expires, returns a [migrations.LockTimeoutError] identifying the process holding the
+// lock.
+func (tx *Tx) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	key := migrations.AdvisoryLockKey(metadataTable)
+
+	err := migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked bool
+		err := tx.Tx.QueryRow(ctx, "select pg_try_advisory_xact_lock($1)", key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		return nil, lockTimeout(ctx, tx.Tx, key, wait, err)
+	}
+
+	// PostgreSQL releases the lock at the end of the transaction
+	return func(context.Context) error {
+		return nil
+	}, nil
+}
+
+// BeginMigration starts a transaction for the migrations package.
+func (db *DB) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx}, nil
+}
+
+// CommitMigration does nothing on a connection, since you're not in a transaction.
+func (db *DB) CommitMigration(ctx context.Context) error {
+	return db.Commit(ctx)
+}
+
+// CloseMigration does nothing on a connection.
+func (db *DB) CloseMigration(ctx context.Context) error {
+	return db.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (db *DB) ExecMigration(ctx context.Context, sql string, args ...any) error {
+	_, err := db.Exec(ctx, sql, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (db *DB) QueryMigration(ctx context.Context, sql string, args ...any) (migrations.Rows, error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationRows{rows}, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (db *DB) QueryRowMigration(ctx context.Context, sql string, args ...any) migrations.Row {
+	return db.QueryRow(ctx, sql, args...)
+}
+
+// BeginMigration starts a pseudo nested transaction, i.e. a savepoint, for the
+// migrations package.
+func (tx *Tx) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	newTx, err := tx.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{newTx}, nil
+}
+
+// CommitMigration commits the transaction or releases the savepoint.
+func (tx *Tx) CommitMigration(ctx context.Context) error {
+	return tx.Tx.Commit(ctx)
+}
+
+// CloseMigration rolls back the transaction or savepoint.  Unlike [Tx.Close], does not
+// return an error if the transaction was already committed.
+func (tx *Tx) CloseMigration(ctx context.Context) error {
+	err := tx.Tx.Rollback(ctx)
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (tx *Tx) ExecMigration(ctx context.Context, sql string, args ...any) error {
+	_, err := tx.Exec(ctx, sql, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (tx *Tx) QueryMigration(ctx context.Context, sql string, args ...any) (migrations.Rows, error) {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationRows{rows}, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (tx *Tx) QueryRowMigration(ctx context.Context, sql string, args ...any) migrations.Row {
+	return tx.QueryRow(ctx, sql, args...)
+}
+
+// Adapts the pgx.Rows to the migrations.Rows interface, which expects Close to return an
+// error like sql.Rows.
+type migrationRows struct {
+	pgx.Rows
+}
+
+// Close the rows, releasing the connection.
+func (rows migrationRows) Close() error {
+	rows.Rows.Close()
+	return nil
+}
+
+// Queries a single row; implemented by pgxpool.Conn and pgx.Tx.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// If the error is a migrations.ErrLockTimeout, returns a LockTimeoutError identifying the
+// process holding the lock.  Otherwise returns the error.
+func lockTimeout(ctx context.Context, q rowQuerier, key int64, wait time.Duration, err error) error {
+	if !errors.Is(err, migrations.ErrLockTimeout) {
+		return err
+	}
+
+	lockErr := &migrations.LockTimeoutError{Wait: wait}
+	classID, objID := support.LockKeyArgs(key)
+
+	row := q.QueryRow(ctx, support.LockHolderQuery, classID, objID)
+	_ = row.Scan(&lockErr.PID, &lockErr.ApplicationName, &lockErr.ClientAddr)
+
+	return lockErr
+}
@@ -2,74 +2,43 @@ package std
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
-	"fmt"
-	"regexp"
+	"time"
 
-	"github.com/sbowman/drawbridge"
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/postgres/internal/support"
 )
 
+// MetadataVersion is the current format version of the metadata table.
+const MetadataVersion = support.MetadataVersion
+
 var (
 	// ErrInvalidSchemaName returned if the schema name isn't in a valid format
 	// (letters, numbers, underscores).
-	ErrInvalidSchemaName = errors.New("metadata schema name contains invalid characters")
+	ErrInvalidSchemaName = support.ErrInvalidSchemaName
 
 	// ErrInvalidTableName returned if the table name isn't in a valid format
 	// (letters, numbers, underscores).
-	ErrInvalidTableName = errors.New("metadata table name contains invalid characters")
+	ErrInvalidTableName = support.ErrInvalidTableName
 
 	// ErrTableNameRequired returned if the table name is blank.
-	ErrTableNameRequired = errors.New("metadata table name is required")
+	ErrTableNameRequired = support.ErrTableNameRequired
 )
 
 // CreateMetadata creates the migrations package's metadata table in the requested schema
-// and table if it doesn't already exist.  Returns the table name to use for the metadata.
+// and table if it doesn't already exist.  If the table was created by an older version of
+// the migrations package, upgrades it.  Returns the table name to use for the metadata.
 func (db *DB) CreateMetadata(ctx context.Context, schema, table string) (string, error) {
-	if stmt, err := createSchemaStmt(schema); err != nil {
-		return "", err
-	} else if stmt != "" && missingMetadataSchema(ctx, db, schema) {
-		if _, err := db.Exec(ctx, stmt); err != nil {
-			return "", err
-		}
-	}
-
-	name, err := metadataName(schema, table)
-	if err != nil {
-		return "", err
-	}
-
-	if missingMetadataTable(ctx, db, schema, table) {
-		if _, err := db.Exec(ctx, createTableStmt(name)); err != nil {
-			return "", err
-		}
-	}
-
-	return name, nil
+	return support.CreateMetadata(ctx, db, schema, table)
 }
 
 // CreateMetadata creates the migrations package's metadata table in the requested schema
-// and table if it doesn't already exist.  Returns the table name to use for the metadata.
+// and table if it doesn't already exist.  If the table was created by an older version of
+// the migrations package, upgrades it.  Returns the table name to use for the metadata.
 func (tx *Tx) CreateMetadata(ctx context.Context, schema, table string) (string, error) {
-	if stmt, err := createSchemaStmt(schema); err != nil {
-		return "", err
-	} else if stmt != "" && missingMetadataSchema(ctx, tx, schema) {
-		if _, err := tx.Exec(ctx, stmt); err != nil {
-			return "", err
-		}
-	}
-
-	name, err := metadataName(schema, table)
-	if err != nil {
-		return "", err
-	}
-
-	if missingMetadataTable(ctx, tx, schema, table) {
-		if _, err := tx.Exec(ctx, createTableStmt(name)); err != nil {
-			return "", err
-		}
-	}
-
-	return name, nil
+	return support.CreateMetadata(ctx, tx, schema, table)
 }
 
 // LockMetadata panics because it makes no sense to lock the table out of a transaction.
@@ -95,82 +64,184 @@ func (tx *Tx) UnlockMetadata(_ context.Context, _ string) {
 	// Do nothing...
 }
 
-// Returns true if the provided schema doesn't exist in the database.  If the schema is
-// blank, returns false.
-func missingMetadataSchema(ctx context.Context, span drawbridge.Span, schema string) bool {
-	if schema == "" {
-		return false
-	}
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.
+func (db *DB) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return support.MetadataColumns(ctx, db, schema, table)
+}
 
-	var result bool
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.
+func (tx *Tx) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return support.MetadataColumns(ctx, tx, schema, table)
+}
 
-	// fmt.Println("does", schema, "exist?")
+// AdvisoryLock holds a PostgreSQL session-level advisory lock on a dedicated connection
+// for the entire migrations run, waiting up to `wait` for another process to release it.
+// If the wait expires, returns a [migrations.LockTimeoutError] identifying the process
+// holding the lock.
+func (db *DB) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := migrations.AdvisoryLockKey(metadataTable)
 
-	row := span.QueryRow(ctx, "SELECT not(exists(select schema_name FROM information_schema.schemata WHERE schema_name = $1))", schema)
-	if err := row.Scan(&result); err != nil {
-		panic(fmt.Sprintf("Unable to query for the metadata schema, %s", err))
+	err = migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked bool
+		err := conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		err = lockTimeout(ctx, conn, key, wait, err)
+		_ = conn.Close()
+		return nil, err
 	}
 
-	// fmt.Println("metadata schema missing?", result)
+	return func(ctx context.Context) error {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), "select pg_advisory_unlock($1)", key)
+		if err != nil {
+			// Discard the connection rather than return it to the pool still locked
+			_ = conn.Raw(func(any) error {
+				return driver.ErrBadConn
+			})
+		}
 
-	return result
+		_ = conn.Close()
+		return err
+	}, nil
 }
 
-// Returns true if the given table is missing from the database. If table is blank,
-// assumes "public."
-func missingMetadataTable(ctx context.Context, span drawbridge.Span, schema, table string) bool {
-	if schema == "" {
-		schema = "public"
+// SetTimeouts sets the lock and statement timeouts with `SET LOCAL`, so they only apply
+// to the rest of the transaction.  A timeout of zero isn't set.
+func (tx *Tx) SetTimeouts(ctx context.Context, lockTimeout, statementTimeout time.Duration) error {
+	return support.SetTimeouts(ctx, tx, lockTimeout, statementTimeout)
+}
+
+// AdvisoryLock holds a PostgreSQL transaction-level advisory lock until the transaction
+// completes, waiting up to `wait` for another process to release it.  If the wait
+// expires, returns a [migrations.LockTimeoutError] identifying the process holding the
+// lock.
+func (tx *Tx) AdvisoryLock(ctx context.Context, metadataTable string, wait time.Duration) (func(context.Context) error, error) {
+	key := migrations.AdvisoryLockKey(metadataTable)
+
+	err := migrations.PollLock(ctx, wait, func(ctx context.Context) (bool, error) {
+		var locked bool
+		err := tx.QueryRow(ctx, "select pg_try_advisory_xact_lock($1)", key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		return nil, lockTimeout(ctx, tx.Tx, key, wait, err)
 	}
 
-	row := span.QueryRow(ctx, "select not(exists(select 1 from pg_catalog.pg_class c "+
-		"join pg_catalog.pg_namespace n "+
-		"on n.oid = c.relnamespace "+
-		"where n.nspname = $1 and c.relname = $2))", schema, table)
+	// PostgreSQL releases the lock at the end of the transaction
+	return func(context.Context) error {
+		return nil
+	}, nil
+}
 
-	var result bool
-	if err := row.Scan(&result); err != nil {
-		panic(fmt.Sprintf("Unable to query for the metadata table, %s", err))
+// BeginMigration starts a transaction for the migrations package.
+func (db *DB) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	tx, err := db.newTx(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return result
+	return tx, nil
 }
 
-var validObjName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+// CommitMigration does nothing at the DB level.
+func (db *DB) CommitMigration(_ context.Context) error {
+	return db.Commit()
+}
 
-// Verify the schema and table names, and returns the combined name.  If schema is blank,
-// returns just the table name.  Otherwise, returns "schema.table."
-func metadataName(schema, table string) (string, error) {
-	if schema != "" && !validObjName.MatchString(schema) {
-		return "", ErrInvalidSchemaName
-	}
+// CloseMigration does nothing at the DB level.
+func (db *DB) CloseMigration(ctx context.Context) error {
+	return db.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (db *DB) ExecMigration(ctx context.Context, sql string, args ...any) error {
+	_, err := db.Exec(ctx, sql, args...)
+	return err
+}
 
-	if table == "" {
-		return "", ErrTableNameRequired
+// QueryMigration executes a query for the migrations package that returns rows.
+func (db *DB) QueryMigration(ctx context.Context, sql string, args ...any) (migrations.Rows, error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
 	}
 
-	if !validObjName.MatchString(table) {
-		return "", ErrInvalidTableName
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (db *DB) QueryRowMigration(ctx context.Context, sql string, args ...any) migrations.Row {
+	return db.QueryRow(ctx, sql, args...)
+}
+
+// BeginMigration starts a subtransaction for the migrations package.
+func (tx *Tx) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	if _, err := tx.Begin(ctx); err != nil {
+		return nil, err
 	}
 
-	return fmt.Sprintf("%s.%s", schema, table), nil
+	return tx, nil
+}
+
+// CommitMigration commits the transaction or subtransaction.
+func (tx *Tx) CommitMigration(_ context.Context) error {
+	return tx.Commit()
 }
 
-// Validates the schema name and returns the create schema statement, if necessary.  If
-// the schema is blank, returns a blank string and no error, meaning no need to create
-// the schema.
-func createSchemaStmt(schema string) (string, error) {
-	if schema == "" {
-		return "", nil
-	} else if !validObjName.MatchString(schema) {
-		return "", ErrInvalidSchemaName
+// CloseMigration rolls back the transaction or subtransaction, if it hasn't been
+// committed.
+func (tx *Tx) CloseMigration(ctx context.Context) error {
+	return tx.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (tx *Tx) ExecMigration(ctx context.Context, sql string, args ...any) error {
+	_, err := tx.Exec(ctx, sql, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (tx *Tx) QueryMigration(ctx context.Context, sql string, args ...any) (migrations.Rows, error) {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
 	}
 
-	return fmt.Sprintf("create schema if not exists %s", schema), nil
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (tx *Tx) QueryRowMigration(ctx context.Context, sql string, args ...any) migrations.Row {
+	return tx.QueryRow(ctx, sql, args...)
+}
+
+// Queries a single row; implemented by sql.Conn and sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
-// Validates the schema and table names and returns the table name and create table
-// statement.
-func createTableStmt(metadataTable string) string {
-	return fmt.Sprintf("create table %s(migration varchar(1024) not null primary key, rollback text)", metadataTable)
+// If the error is a migrations.ErrLockTimeout, returns a LockTimeoutError identifying the
+// process holding the lock.  Otherwise returns the error.
+func lockTimeout(ctx context.Context, q rowQuerier, key int64, wait time.Duration, err error) error {
+	if !errors.Is(err, migrations.ErrLockTimeout) {
+		return err
+	}
+
+	lockErr := &migrations.LockTimeoutError{Wait: wait}
+	classID, objID := support.LockKeyArgs(key)
+
+	row := q.QueryRowContext(ctx, support.LockHolderQuery, classID, objID)
+	_ = row.Scan(&lockErr.PID, &lockErr.ApplicationName, &lockErr.ClientAddr)
+
+	return lockErr
 }
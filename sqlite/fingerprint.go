@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/sbowman/drawbridge/migrations"
+)
+
+// Describes each column, foreign key, index, view, and trigger, skipping the metadata
+// tables ($1 and $2).
+const fingerprintQuery = `
+select 'column ' || m.name || '.' || p.name || ' ' || p.type ||
+       case when p."notnull" then ' not null' else '' end ||
+       coalesce(' default ' || p.dflt_value, '') ||
+       case when p.pk > 0 then ' primary key' else '' end
+from sqlite_master m
+join pragma_table_info(m.name) p
+where m.type = 'table' and m.name not like 'sqlite_%' and m.name not in ($1, $2)
+union all
+select 'foreign key ' || m.name || '.' || f."from" || ' references ' || f."table" || coalesce('.' || f."to", '')
+from sqlite_master m
+join pragma_foreign_key_list(m.name) f
+where m.type = 'table' and m.name not in ($1, $2)
+union all
+select m.type || ' ' || m.name || coalesce(': ' || m.sql, '')
+from sqlite_master m
+where m.type in ('index', 'view', 'trigger') and m.tbl_name not in ($1, $2)`
+
+// Fingerprint describes the tables, columns, foreign keys, indexes, views, and triggers in
+// the SQLite3 database, one per line, excluding the metadata table.  Use it with
+// [migrations.Options.CheckReversible] to test each migration's "down" SQL undoes its
+// "up" SQL:
+//
+//	err := migrations.WithDirectory("./sql").CheckReversible(ctx, db, sqlite.Fingerprint)
+func Fingerprint(ctx context.Context, span migrations.Span, metadataTable string) (string, error) {
+	rows, err := span.QueryMigration(ctx, fingerprintQuery, metadataTable, metadataTable+"_version")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var lines []string
+
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,71 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Is a legacy metadata table in an attached database adopted, rather than the migrations
+// applied again?
+func TestAdoptLegacy(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer func() {
+		for _, table := range []string{"samples", "applied", "legacy_migrations", "legacy_migrations_version"} {
+			if _, err := db.Exec(ctx, "drop table if exists "+table); err != nil {
+				t.Fatalf("Unable to drop table %s: %s", table, err)
+			}
+		}
+	}()
+
+	_, err := db.Exec(ctx, "create table applied (migration varchar(1024) not null primary key, rollback text)")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "insert into applied (migration, rollback) values ('1-create-sample.sql', 'drop table samples')")
+	require.Nil(t, err)
+
+	_, err = db.Exec(ctx, "create table samples (name varchar(64) primary key)")
+	require.Nil(t, err)
+
+	options := migrations.WithReader(migrations.FromFS(reversibleFS)).
+		WithDirectory("sql").
+		WithSchemaTable("legacy_migrations").
+		WithLegacyTables("public.schema_migrations", "main.applied")
+
+	err = options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	applied, err := migrations.Applied(ctx, db, "legacy_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-add-email.sql"}, applied)
+
+	var rollback string
+	row := db.QueryRow(ctx, "select rollback from legacy_migrations where migration = '1-create-sample.sql'")
+	assert.Nil(row.Scan(&rollback))
+	assert.Equal("drop table samples", rollback)
+
+	// Once adopted, the metadata table isn't locked to look for the legacy tables again
+	counter := &beginCounter{DB: db}
+
+	report, err := options.AdoptLegacy(ctx, counter)
+	assert.Nil(err)
+	assert.Zero(report)
+	assert.Zero(counter.begins)
+}
+
+// Counts the migration transactions started.
+type beginCounter struct {
+	*sqlite.DB
+	begins int
+}
+
+func (c *beginCounter) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	c.begins++
+	return c.DB.BeginMigration(ctx)
+}
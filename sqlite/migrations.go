@@ -5,8 +5,51 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+
+	"github.com/sbowman/drawbridge"
+	"github.com/sbowman/drawbridge/migrations"
 )
 
+// MetadataVersion is the current format version of the metadata table.
+//
+// * Version 1: migration, rollback
+// * Version 2: checksum
+// * Version 3: applied_at, duration_ms, applied_by
+// * Version 4: dirty
+// * Version 5: irreversible
+// * Version 6: squashed_by
+// * Version 7: repeatable
+// * Version 8: env
+const MetadataVersion = 8
+
+// The statements to upgrade the metadata table to each version, from the version before
+// it.  Each statement is formatted with the metadata table name.
+var metadataUpgrades = map[int][]string{
+	2: {
+		"alter table %s add column checksum varchar(64)",
+	},
+	3: {
+		"alter table %s add column applied_at timestamp",
+		"alter table %s add column duration_ms integer",
+		"alter table %s add column applied_by varchar(255)",
+	},
+	4: {
+		"alter table %s add column dirty boolean not null default 0",
+	},
+	5: {
+		"alter table %s add column irreversible boolean not null default 0",
+	},
+	6: {
+		"alter table %s add column squashed_by varchar(1024)",
+	},
+	7: {
+		"alter table %s add column repeatable boolean not null default 0",
+	},
+	8: {
+		"alter table %s add column env varchar(255)",
+	},
+}
+
 var (
 	// ErrInvalidTableName returned if the table name isn't in a valid format
 	// (letters, numbers, underscores).
@@ -17,33 +60,19 @@ var (
 )
 
 // CreateMetadata creates the table in the database used to track the state of the
-// database migrations.  Note that SQLite3 does not support schemas, so the schema is
+// database migrations.  If the table was created by an older version of the migrations
+// package, upgrades it.  Note that SQLite3 does not support schemas, so the schema is
 // ignored.
 func (db *DB) CreateMetadata(ctx context.Context, _, table string) (string, error) {
-	if err := isValidTableName(table); err != nil {
-		return "", err
-	}
-
-	if _, err := db.Exec(ctx, createTableStmt(table)); err != nil {
-		return "", err
-	}
-
-	return table, nil
+	return createMetadata(ctx, db, table)
 }
 
 // CreateMetadata creates the table in the database used to track the state of the
-// database migrations.  Note that SQLite3 does not support schemas, so the schema is
+// database migrations.  If the table was created by an older version of the migrations
+// package, upgrades it.  Note that SQLite3 does not support schemas, so the schema is
 // ignored.
 func (tx *Tx) CreateMetadata(ctx context.Context, _, table string) (string, error) {
-	if err := isValidTableName(table); err != nil {
-		return "", err
-	}
-
-	if _, err := tx.Exec(ctx, createTableStmt(table)); err != nil {
-		return "", err
-	}
-
-	return table, nil
+	return createMetadata(ctx, tx, table)
 }
 
 // LockMetadata is unsupported, as it makes no sense in SQLite3.
@@ -68,6 +97,102 @@ func (tx *Tx) UnlockMetadata(_ context.Context, _ string) {
 	// Do nothing...
 }
 
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.  The
+// schema is an attached database, e.g. `main`; other schemas, such as PostgreSQL's
+// `public`, don't exist in SQLite3.
+func (db *DB) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return metadataColumns(ctx, db, schema, table)
+}
+
+// MetadataColumns returns the names of the table's columns, or nil if the table doesn't
+// exist.  The migrations package uses this to find a legacy metadata table to adopt.  The
+// schema is an attached database, e.g. `main`; other schemas, such as PostgreSQL's
+// `public`, don't exist in SQLite3.
+func (tx *Tx) MetadataColumns(ctx context.Context, schema, table string) ([]string, error) {
+	return metadataColumns(ctx, tx, schema, table)
+}
+
+// BeginMigration starts a transaction for the migrations package.
+func (db *DB) BeginMigration(ctx context.Context) (migrations.Span, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTx(tx, nil), nil
+}
+
+// CommitMigration does nothing on a connection, since you're not in a transaction.
+func (db *DB) CommitMigration(_ context.Context) error {
+	return db.Commit()
+}
+
+// CloseMigration does nothing on a connection.
+func (db *DB) CloseMigration(ctx context.Context) error {
+	return db.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (db *DB) ExecMigration(ctx context.Context, query string, args ...any) error {
+	_, err := db.Exec(ctx, query, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (db *DB) QueryMigration(ctx context.Context, query string, args ...any) (migrations.Rows, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (db *DB) QueryRowMigration(ctx context.Context, query string, args ...any) migrations.Row {
+	return db.QueryRow(ctx, query, args...)
+}
+
+// BeginMigration starts a pseudo nested transaction for the migrations package.
+func (tx *Tx) BeginMigration(_ context.Context) (migrations.Span, error) {
+	return newTx(tx.Tx, tx), nil
+}
+
+// CommitMigration commits the transaction, or marks the pseudo nested transaction as
+// committed.
+func (tx *Tx) CommitMigration(_ context.Context) error {
+	return tx.Commit()
+}
+
+// CloseMigration rolls back the transaction if it hasn't been committed.
+func (tx *Tx) CloseMigration(ctx context.Context) error {
+	return tx.Close(ctx)
+}
+
+// ExecMigration executes the migration SQL without returning any rows.
+func (tx *Tx) ExecMigration(ctx context.Context, query string, args ...any) error {
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
+
+// QueryMigration executes a query for the migrations package that returns rows.
+func (tx *Tx) QueryMigration(ctx context.Context, query string, args ...any) (migrations.Rows, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRowMigration executes a query for the migrations package that is expected to
+// return at most one row.
+func (tx *Tx) QueryRowMigration(ctx context.Context, query string, args ...any) migrations.Row {
+	return tx.QueryRow(ctx, query, args...)
+}
+
 var validObjName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
 // Validates the table name and returns the table name.
@@ -83,6 +208,190 @@ func isValidTableName(table string) error {
 	return nil
 }
 
+// Creates the metadata table if it's missing, or upgrades the table if it was created by
+// an older version of the migrations package.
+func createMetadata(ctx context.Context, span drawbridge.Span, table string) (string, error) {
+	if err := isValidTableName(table); err != nil {
+		return "", err
+	}
+
+	tx, err := span.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer TxClose(ctx, tx)
+
+	missing, err := missingMetadataTable(ctx, tx, table)
+	if err != nil {
+		return "", err
+	}
+
+	if missing {
+		if _, err := tx.Exec(ctx, createTableStmt(table)); err != nil {
+			return "", err
+		}
+
+		if _, err := tx.Exec(ctx, createVersionStmt(table)); err != nil {
+			return "", err
+		}
+
+		if _, err := tx.Exec(ctx, "insert into "+table+"_version (version) values ($1)", MetadataVersion); err != nil {
+			return "", err
+		}
+	} else if err := upgradeMetadata(ctx, tx, table); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return table, nil
+}
+
+// Upgrades the metadata table in place to the latest MetadataVersion.  SQLite3 serializes
+// the writes in the transaction, so there's no need to lock the table.
+func upgradeMetadata(ctx context.Context, span drawbridge.Span, table string) error {
+	version, err := metadataVersion(ctx, span, table)
+	if err != nil {
+		return err
+	}
+
+	if version >= MetadataVersion {
+		return nil
+	}
+
+	for v := version + 1; v <= MetadataVersion; v++ {
+		for _, stmt := range metadataUpgrades[v] {
+			if _, err := span.Exec(ctx, fmt.Sprintf(stmt, table)); err != nil {
+				return fmt.Errorf("unable to upgrade metadata table %s to version %d: %w", table, v, err)
+			}
+		}
+	}
+
+	_, err = span.Exec(ctx, "update "+table+"_version set version = $1", MetadataVersion)
+	return err
+}
+
+// Returns the format version of the metadata table.  Metadata tables created before the
+// format was versioned don't have a version table, so the version is determined by the
+// columns in the table, and the version table is created.
+func metadataVersion(ctx context.Context, span drawbridge.Span, table string) (int, error) {
+	missing, err := missingMetadataTable(ctx, span, table+"_version")
+	if err != nil {
+		return 0, err
+	}
+
+	if !missing {
+		var version int
+
+		row := span.QueryRow(ctx, "select version from "+table+"_version")
+		if err := row.Scan(&version); err != nil {
+			return 0, err
+		}
+
+		return version, nil
+	}
+
+	version := 1
+	if missing, err := missingMetadataColumn(ctx, span, table, "checksum"); err != nil {
+		return 0, err
+	} else if !missing {
+		version = 2
+	}
+
+	if _, err := span.Exec(ctx, createVersionStmt(table)); err != nil {
+		return 0, err
+	}
+
+	if _, err := span.Exec(ctx, "insert into "+table+"_version (version) values ($1)", version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Returns true if the table doesn't exist in the database.
+func missingMetadataTable(ctx context.Context, span drawbridge.Span, table string) (bool, error) {
+	var missing bool
+
+	row := span.QueryRow(ctx, "select not(exists(select 1 from sqlite_master where type = 'table' and name = $1))", table)
+	if err := row.Scan(&missing); err != nil {
+		return false, err
+	}
+
+	return missing, nil
+}
+
+// Returns true if the metadata table is missing the column, i.e. the metadata table was
+// created by an older version of the migrations package.
+func missingMetadataColumn(ctx context.Context, span drawbridge.Span, table, column string) (bool, error) {
+	var missing bool
+
+	row := span.QueryRow(ctx, "select not(exists(select 1 from pragma_table_info($1) where name = $2))", table, column)
+	if err := row.Scan(&missing); err != nil {
+		return false, err
+	}
+
+	return missing, nil
+}
+
+// Returns the names of the table's columns in the attached database, or nil if the
+// database isn't attached or the table doesn't exist.
+func metadataColumns(ctx context.Context, span drawbridge.Span, schema, table string) ([]string, error) {
+	if schema == "" {
+		schema = "main"
+	}
+
+	var attached bool
+
+	row := span.QueryRow(ctx, "select exists(select 1 from pragma_database_list where name = $1)", schema)
+	if err := row.Scan(&attached); err != nil {
+		return nil, err
+	}
+
+	if !attached {
+		return nil, nil
+	}
+
+	rows, err := span.Query(ctx, "select name from pragma_table_info($1, $2) order by cid", table, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
 func createTableStmt(metadataTable string) string {
-	return fmt.Sprintf("create table if not exists %s(migration varchar(1024) not null primary key, rollback text)", metadataTable)
+	return fmt.Sprintf("create table if not exists %s("+
+		"migration varchar(1024) not null primary key, "+
+		"rollback text, "+
+		"checksum varchar(64), "+
+		"applied_at timestamp default current_timestamp, "+
+		"duration_ms integer, "+
+		"applied_by varchar(255), "+
+		"dirty boolean not null default 0, "+
+		"irreversible boolean not null default 0, "+
+		"squashed_by varchar(1024), "+
+		"repeatable boolean not null default 0, "+
+		"env varchar(255))", metadataTable)
+}
+
+// Returns the create table statement for the table tracking the metadata table's format
+// version.
+func createVersionStmt(metadataTable string) string {
+	return fmt.Sprintf("create table if not exists %s_version(version integer not null)", metadataTable)
 }
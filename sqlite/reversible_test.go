@@ -0,0 +1,97 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/sbowman/drawbridge/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var reversibleFS = fstest.MapFS{
+	"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up
+create table samples (name varchar(64) primary key);
+
+--- !Down
+drop table samples;
+`)},
+	"sql/2-add-email.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column email varchar(1024);
+create unique index idx_sample_email on samples (email);
+
+--- !Down
+drop index idx_sample_email;
+alter table samples drop column email;
+`)},
+}
+
+// Do migrations whose "down" SQL undoes the "up" SQL pass?
+func TestCheckReversible(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer cleanReversible(t, ctx)
+
+	options := migrations.WithReader(migrations.FromFS(reversibleFS)).
+		WithDirectory("sql").
+		WithSchemaTable("reversible_migrations")
+
+	err := options.CheckReversible(ctx, db, sqlite.Fingerprint)
+	require.Nil(t, err)
+
+	// The migrations are left applied
+	applied, err := migrations.Applied(ctx, db, "reversible_migrations")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"1-create-sample.sql", "2-add-email.sql"}, applied)
+
+	fingerprint, err := sqlite.Fingerprint(ctx, db, "reversible_migrations")
+	assert.Nil(err)
+	assert.Contains(fingerprint, "column samples.email varchar(1024)")
+	assert.Contains(fingerprint, "index idx_sample_email")
+	assert.NotContains(fingerprint, "reversible_migrations")
+}
+
+// Is a migration whose "down" SQL leaves changes behind reported?
+func TestCheckReversibleFails(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer cleanReversible(t, ctx)
+
+	broken := fstest.MapFS{
+		"sql/1-create-sample.sql": reversibleFS["sql/1-create-sample.sql"],
+		"sql/2-add-phone.sql": &fstest.MapFile{Data: []byte(`--- !Up
+alter table samples add column phone varchar(32);
+create index idx_sample_name on samples (name);
+
+--- !Down
+alter table samples drop column phone;
+`)},
+	}
+
+	options := migrations.WithReader(migrations.FromFS(broken)).
+		WithDirectory("sql").
+		WithSchemaTable("reversible_migrations")
+
+	err := options.CheckReversible(ctx, db, sqlite.Fingerprint)
+	require.NotNil(t, err)
+	assert.True(errors.Is(err, migrations.ErrNotReversible))
+
+	var reversible *migrations.ReversibleError
+	require.True(t, errors.As(err, &reversible))
+	assert.Equal("2-add-phone.sql", reversible.Migration)
+	assert.Equal("+ index idx_sample_name: CREATE INDEX idx_sample_name on samples (name)", reversible.Diff)
+}
+
+// Drops the tables created by the reversibility tests.
+func cleanReversible(t *testing.T, ctx context.Context) {
+	for _, table := range []string{"samples", "reversible_migrations", "reversible_migrations_version"} {
+		if _, err := db.Exec(ctx, "drop table if exists "+table); err != nil {
+			t.Fatalf("Unable to drop %s: %s", table, err)
+		}
+	}
+}
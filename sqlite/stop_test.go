@@ -0,0 +1,49 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Is a migration with an empty /stop "down" section applied, and does rolling back stop
+// at it?
+func TestStop(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	defer func() {
+		for _, table := range []string{"samples", "stop_migrations", "stop_migrations_version"} {
+			if _, err := db.Exec(ctx, "drop table if exists "+table); err != nil {
+				t.Fatalf("Unable to drop %s: %s", table, err)
+			}
+		}
+	}()
+
+	stopFS := fstest.MapFS{
+		"sql/1-create-sample.sql": reversibleFS["sql/1-create-sample.sql"],
+		"sql/2-drop-legacy.sql": &fstest.MapFile{Data: []byte(`--- !Up
+delete from samples;
+
+--- !Down /stop
+`)},
+	}
+
+	options := migrations.WithReader(migrations.FromFS(stopFS)).
+		WithDirectory("sql").
+		WithSchemaTable("stop_migrations")
+
+	err := options.Apply(ctx, db)
+	require.Nil(t, err)
+
+	err = options.Rollback(ctx, db, 1)
+
+	var stopped *migrations.StoppedError
+	require.True(t, errors.As(err, &stopped))
+	assert.Equal("2-drop-legacy.sql", stopped.Migration)
+}
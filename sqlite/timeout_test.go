@@ -0,0 +1,40 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sbowman/drawbridge/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// Does a migration that sets a lock timeout fail clearly, rather than send PostgreSQL's
+// `SET LOCAL` to SQLite?
+func TestTimeoutsUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	defer func() {
+		for _, table := range []string{"samples", "timeout_migrations", "timeout_migrations_version"} {
+			if _, err := db.Exec(ctx, "drop table if exists "+table); err != nil {
+				t.Fatalf("Unable to drop %s: %s", table, err)
+			}
+		}
+	}()
+
+	timeoutFS := fstest.MapFS{
+		"sql/1-create-sample.sql": &fstest.MapFile{Data: []byte(`--- !Up lock_timeout=5s
+create table samples (name varchar(64));
+
+--- !Down
+drop table samples;
+`)},
+	}
+
+	err := migrations.WithReader(migrations.FromFS(timeoutFS)).
+		WithDirectory("sql").
+		WithSchemaTable("timeout_migrations").
+		Apply(ctx, db)
+	assert.True(t, errors.Is(err, migrations.ErrTimeoutsUnsupported), "expected ErrTimeoutsUnsupported, got %v", err)
+}